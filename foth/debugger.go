@@ -0,0 +1,211 @@
+// This file contains the REPL's debugger.
+//
+// Breakpoints are set with `break WORD`, and removed with `unbreak WORD`.
+// If the user has defined a word named `break`, or `unbreak`, then that
+// word is executed instead.
+// When a breakpoint is hit we show a sub-prompt which allows the user to
+// step through the word, and inspect the state of the interpreter.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/skx/foth/foth/eval"
+)
+
+// debugger holds the state of our debugger.
+type debugger struct {
+	// reader is where we read commands from.
+	reader *bufio.Reader
+}
+
+// command handles the REPL-level debugger commands, returning true if
+// the given line was one.
+func (d *debugger) command(ev *eval.Eval, line string) bool {
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+
+	name := strings.ToLower(fields[0])
+	if defined(ev, name) {
+		return false
+	}
+
+	switch name {
+	case "break":
+		if len(fields) == 1 {
+			fmt.Printf("breakpoints: %s\n", strings.Join(ev.Breakpoints(), " "))
+			return true
+		}
+		for _, name := range fields[1:] {
+			err := ev.SetBreakpoint(name)
+			if err != nil {
+				fmt.Printf("ERROR: %s\n", err.Error())
+			}
+		}
+		return true
+	case "unbreak":
+		for _, name := range fields[1:] {
+			ev.ClearBreakpoint(name)
+		}
+		return true
+	}
+	return false
+}
+
+// defined returns true if the dictionary contains a word with the given
+// name, which must be lower-case.
+func defined(ev *eval.Eval, name string) bool {
+	for _, word := range ev.Dictionary {
+		if word.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pause is invoked by the interpreter when execution is paused, and
+// prompts the user for commands until they choose to resume.
+func (d *debugger) pause(ev *eval.Eval) eval.DebugAction {
+
+	d.where(ev)
+
+	for {
+		fmt.Printf("debug> ")
+
+		text, err := d.reader.ReadString('\n')
+		if err != nil {
+			return eval.DebugAbort
+		}
+
+		switch strings.TrimSpace(text) {
+		case "s", "step":
+			return eval.DebugStep
+		case "n", "next":
+			return eval.DebugStepOver
+		case "c", "continue":
+			return eval.DebugContinue
+		case "q", "abort":
+			return eval.DebugAbort
+		case "l", "list":
+			d.list(ev)
+		case "bt", "frames":
+			d.frames(ev)
+		case ".s", "stack":
+			d.stack(ev)
+		case "loops":
+			d.loops(ev)
+		case "vars":
+			d.vars(ev)
+		case "":
+			// nop
+		default:
+			fmt.Printf("Commands:\n")
+			fmt.Printf("  s, step      Execute the next instruction, stepping into words.\n")
+			fmt.Printf("  n, next      Execute the next instruction, stepping over words.\n")
+			fmt.Printf("  c, continue  Continue until the next breakpoint.\n")
+			fmt.Printf("  q, abort     Abort execution.\n")
+			fmt.Printf("  l, list      Show the current word, marking the next instruction.\n")
+			fmt.Printf("  bt, frames   Show the words which are executing.\n")
+			fmt.Printf("  .s, stack    Show the stack.\n")
+			fmt.Printf("  loops        Show the loops which are executing.\n")
+			fmt.Printf("  vars         Show the variables.\n")
+		}
+	}
+}
+
+// current returns the frame we're paused within.
+func (d *debugger) current(ev *eval.Eval) eval.Frame {
+	frames := ev.Frames()
+	return frames[len(frames)-1]
+}
+
+// where shows the instruction we're paused before.
+func (d *debugger) where(ev *eval.Eval) {
+
+	frame := d.current(ev)
+
+	codes, _ := ev.Decompile(frame.Index)
+	for _, code := range codes {
+		if code.Offset == frame.IP {
+			fmt.Printf("%s+%d: %s\n", frame.Word, frame.IP, code.Text)
+			return
+		}
+	}
+	fmt.Printf("%s [Native]\n", frame.Word)
+}
+
+// list shows the current word, with the next instruction marked.
+func (d *debugger) list(ev *eval.Eval) {
+
+	frame := d.current(ev)
+
+	codes, _ := ev.Decompile(frame.Index)
+	if len(codes) == 0 {
+		fmt.Printf("Word '%s' - [Native]\n", frame.Word)
+		return
+	}
+
+	fmt.Printf("Word '%s'\n", frame.Word)
+	for _, code := range codes {
+		marker := "  "
+		if code.Offset == frame.IP {
+			marker = "=>"
+		}
+		fmt.Printf("%s %d: %s\n", marker, code.Offset, code.Text)
+	}
+}
+
+// frames shows the words which are executing, innermost first.
+func (d *debugger) frames(ev *eval.Eval) {
+	frames := ev.Frames()
+	for i := len(frames) - 1; i >= 0; i-- {
+		fmt.Printf("  %s+%d\n", frames[i].Word, frames[i].IP)
+	}
+}
+
+// stack shows the contents of the stack, and the floating-point stack
+// if it is in use.
+func (d *debugger) stack(ev *eval.Eval) {
+	fmt.Printf("<len:%d>", ev.Stack.Len())
+	for i := 0; i < ev.Stack.Len(); i++ {
+		fmt.Printf(" %v", ev.Stack.AtCell(i))
+	}
+	fmt.Printf("\n")
+
+	if ev.FStack.IsEmpty() {
+		return
+	}
+	fmt.Printf("<f:len:%d>", ev.FStack.Len())
+	for i := 0; i < ev.FStack.Len(); i++ {
+		fmt.Printf(" %v", ev.FStack.AtCell(i))
+	}
+	fmt.Printf("\n")
+}
+
+// loops shows the loops which are executing, innermost first.
+func (d *debugger) loops(ev *eval.Eval) {
+	loops := ev.Loops()
+	if len(loops) == 0 {
+		fmt.Printf("no loops\n")
+	}
+	for i := len(loops) - 1; i >= 0; i-- {
+		fmt.Printf("  i:%d start:%d max:%d\n", loops[i].Current, loops[i].Start, loops[i].Max)
+	}
+}
+
+// vars shows the names and values of all variables.
+func (d *debugger) vars(ev *eval.Eval) {
+	vars := ev.Variables()
+	if len(vars) == 0 {
+		fmt.Printf("no variables\n")
+	}
+	for _, v := range vars {
+		fmt.Printf("  %s: %v\n", v.Name, v.Value)
+	}
+}
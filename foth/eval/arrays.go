@@ -0,0 +1,304 @@
+// This file contains our arrays, which are created with `array`:
+//
+//	10 array scores        \ an array of ten zeros
+//	42 0 scores a!         \ set the first entry
+//	0 scores a@ .          \ and show it
+//
+// The name of an array pushes a reference to it, which the array words
+// expect to find upon the top of the stack.  Every access is checked
+// against the length of the array.
+
+package eval
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/skx/foth/foth/stack"
+)
+
+// array holds the contents of a single array.
+type array struct {
+	// name holds the name of the array.
+	name string
+
+	// values holds the entries of the array.
+	values []stack.Cell
+}
+
+// GetArray returns the contents of the specified array.
+//
+// This is designed to be used by host-applications which embed
+// this library.
+func (e *Eval) GetArray(name string) ([]float64, error) {
+
+	idx := e.findArray(name)
+	if idx < 0 {
+		return nil, fmt.Errorf("array %s not found", name)
+	}
+
+	res := make([]float64, len(e.arrays[idx].values))
+	for i, c := range e.arrays[idx].values {
+		res[i] = c.Float()
+	}
+	return res, nil
+}
+
+// SetArray replaces the contents of the specified array, defining it
+// if necessary.
+//
+// This is designed to be used by host-applications which embed
+// this library, so Limits.MaxMemory doesn't apply.
+func (e *Eval) SetArray(name string, values []float64) error {
+
+	cells := make([]stack.Cell, len(values))
+	for i, v := range values {
+		cells[i] = stack.FloatCell(v)
+	}
+
+	idx := e.findArray(name)
+	if idx >= 0 {
+		e.arrays[idx].values = cells
+		return nil
+	}
+
+	return e.addArray(name, cells)
+}
+
+// addArray defines a new array with the given name, and contents, along
+// with the word which pushes a reference to it.
+func (e *Eval) addArray(name string, values []stack.Cell) error {
+
+	idx := e.findArray(name)
+	if idx != -1 {
+		e.arrays[idx].name = ""
+	}
+
+	err := e.addReference(name, stack.ArrayCell(int64(len(e.arrays))))
+	if err != nil {
+		return err
+	}
+
+	e.arrays = append(e.arrays, array{name: strings.ToLower(name), values: values})
+	return nil
+}
+
+// addReference defines a word with the given name which pushes the
+// given reference, to an array or map.
+func (e *Eval) addReference(name string, ref stack.Cell) error {
+
+	// is the name used?  If so remove it
+	idx := e.findWord(name)
+	if idx != -1 {
+		e.Dictionary[idx].Name = ""
+	}
+
+	return e.addWord(Word{
+		Name: strings.ToLower(name),
+		Function: func() error {
+			e.Stack.PushCell(ref)
+			return nil
+		},
+	})
+}
+
+// findArray returns the index of the specified array, or -1 if it
+// cannot be found.
+func (e *Eval) findArray(name string) int {
+	name = strings.ToLower(name)
+	for i, a := range e.arrays {
+		if a.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkMemory ensures that growing our memory, arrays, or maps, by the
+// given number of cells won't exceed our limit, or maxCells.
+func (e *Eval) checkMemory(n int64) error {
+	used := int64(len(e.memory))
+	for _, a := range e.arrays {
+		used += int64(len(a.values))
+	}
+	for _, m := range e.maps {
+		used += int64(len(m.values))
+	}
+	if e.limits.MaxMemory > 0 && n > int64(e.limits.MaxMemory)-used {
+		return ErrMemoryLimit
+	}
+	if n > maxCells-used {
+		return fmt.Errorf("cannot allocate %d cells", n)
+	}
+	return nil
+}
+
+// popArray removes the array reference on the top of the stack, and
+// returns the array it refers to.
+func (e *Eval) popArray() (*array, error) {
+	c, err := e.Stack.PopCell()
+	if err != nil {
+		return nil, err
+	}
+	if c.Kind != stack.Array || c.I < 0 || c.I >= int64(len(e.arrays)) {
+		return nil, fmt.Errorf("%s is not an array", c)
+	}
+	return &e.arrays[c.I], nil
+}
+
+// popIndex removes the index on the top of the stack, and returns it,
+// ensuring that it is within the given array.
+func (e *Eval) popIndex(a *array) (int, error) {
+	i, err := e.popInt()
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 || i >= int64(len(a.values)) {
+		return 0, fmt.Errorf("index %d is out of range for the array %s, which has %d entries", i, a.name, len(a.values))
+	}
+	return int(i), nil
+}
+
+// zeros returns the given number of cells, each holding zero.
+func zeros(n int64) []stack.Cell {
+	cells := make([]stack.Cell, n)
+	for i := range cells {
+		cells[i] = stack.IntCell(0)
+	}
+	return cells
+}
+
+// arrayFetch pushes the entry of an array at the given index.
+func (e *Eval) arrayFetch() error {
+	a, err := e.popArray()
+	if err != nil {
+		return err
+	}
+	i, err := e.popIndex(a)
+	if err != nil {
+		return err
+	}
+	e.Stack.PushCell(a.values[i])
+	return nil
+}
+
+// arrayStore stores a value in the entry of an array at the given index.
+func (e *Eval) arrayStore() error {
+	a, err := e.popArray()
+	if err != nil {
+		return err
+	}
+	i, err := e.popIndex(a)
+	if err != nil {
+		return err
+	}
+	value, err := e.Stack.PopCell()
+	if err != nil {
+		return err
+	}
+	a.values[i] = value
+	return nil
+}
+
+// defineArray defines an array, with the name which follows, holding
+// the given number of zeros.
+func (e *Eval) defineArray() error {
+	n, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return fmt.Errorf("invalid array length %d", n)
+	}
+	err = e.checkMemory(n)
+	if err != nil {
+		return fmt.Errorf("array: %w", err)
+	}
+
+	e.defining = func(name string) error {
+		if e.debug {
+			e.debugf("defining array %s\n", name)
+		}
+		return e.addArray(name, zeros(n))
+	}
+	return nil
+}
+
+// fillArray stores a value in every entry of an array.
+func (e *Eval) fillArray() error {
+	a, err := e.popArray()
+	if err != nil {
+		return err
+	}
+	value, err := e.Stack.PopCell()
+	if err != nil {
+		return err
+	}
+	for i := range a.values {
+		a.values[i] = value
+	}
+	return nil
+}
+
+// length pushes the number of entries in an array.
+func (e *Eval) length() error {
+	a, err := e.popArray()
+	if err != nil {
+		return err
+	}
+	e.Stack.PushInt(int64(len(a.values)))
+	return nil
+}
+
+// resize changes the number of entries in an array, new entries are set
+// to zero.
+func (e *Eval) resize() error {
+	a, err := e.popArray()
+	if err != nil {
+		return err
+	}
+	n, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return fmt.Errorf("invalid array length %d", n)
+	}
+
+	if n <= int64(len(a.values)) {
+		a.values = a.values[:n:n]
+		return nil
+	}
+
+	err = e.checkMemory(n - int64(len(a.values)))
+	if err != nil {
+		return fmt.Errorf("resize: %w", err)
+	}
+	a.values = append(a.values, zeros(n-int64(len(a.values)))...)
+	return nil
+}
+
+// reverse reverses the entries of an array.
+func (e *Eval) reverse() error {
+	a, err := e.popArray()
+	if err != nil {
+		return err
+	}
+	for i, j := 0, len(a.values)-1; i < j; i, j = i+1, j-1 {
+		a.values[i], a.values[j] = a.values[j], a.values[i]
+	}
+	return nil
+}
+
+// sortArray sorts the entries of an array into ascending order.
+func (e *Eval) sortArray() error {
+	a, err := e.popArray()
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(a.values, func(i, j int) bool {
+		return stack.Compare(a.values[i], a.values[j]) < 0
+	})
+	return nil
+}
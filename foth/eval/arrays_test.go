@@ -0,0 +1,162 @@
+package eval
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestArrays(t *testing.T) {
+
+	type TestCase struct {
+		input  string
+		output string
+	}
+
+	tests := []TestCase{
+		{"3 array a a length .", "3 "},
+		{"3 array a 2 a a@ .", "0 "},
+		{"3 array a 42 1 a a! 1 a a@ .", "42 "},
+		{"3 array a 1.5 0 a a! 0 a a@ .", "1.5 "},
+		{"0 array a a length .", "0 "},
+		{"3 array A 7 0 a a! 0 A a@ .", "7 "},
+
+		// fill, resize, reverse, and sort
+		{"3 array a 9 a fill 0 a a@ . 2 a a@ .", "9 9 "},
+		{"3 array a 9 a fill 5 a resize a length . 4 a a@ . 2 a a@ .", "5 0 9 "},
+		{"3 array a 1 a resize a length .", "1 "},
+		{"3 array a 1 0 a a! 2 1 a a! 3 2 a a! a reverse 0 a a@ . 2 a a@ .", "3 1 "},
+		{"4 array a 3 0 a a! 1.5 1 a a! -2 2 a a! 1/2r 3 a a! a sort 0 a a@ . 1 a a@ . 2 a a@ . 3 a a@ .", "-2 1/2 1.5 3 "},
+		{"0 array a a sort a reverse a length .", "0 "},
+
+		// arrays may be used within words, and held in variables
+		{": sum 0 over length 0 do over i swap a@ + loop swap drop ; 3 array a 1 a fill a sum .", "3 "},
+		{"3 array a variable v a v ! 5 1 v @ a! 1 a a@ .", "5 "},
+		{"2 array a 2 array b a b = . a a = .", "0 1 "},
+
+		// strings held in arrays are kept alive
+		{"1 array a \"kept\" 0 a a! 100 0 do \"x\" \"y\" s+ drop loop 0 a a@ strprn", "kept"},
+
+		// redefining an array replaces it
+		{"3 array a 5 array a a length .", "5 "},
+	}
+
+	for _, test := range tests {
+
+		e := New()
+		out := e.CaptureOutput()
+
+		err := e.Eval(test.input)
+		if err != nil {
+			t.Fatalf("unexpected error evaluating '%s': %s", test.input, err.Error())
+		}
+		if out.String() != test.output {
+			t.Fatalf("'%s' gave '%s', not '%s'", test.input, out.String(), test.output)
+		}
+		if !e.Stack.IsEmpty() {
+			t.Fatalf("'%s' left items on the stack", test.input)
+		}
+	}
+}
+
+func TestArrayErrors(t *testing.T) {
+
+	tests := []string{
+		"array",
+		"-1 array a",
+		"1.5 array a",
+		"1000000000000000000 array a",
+		"3 array a 3 a a@",
+		"3 array a -1 a a@",
+		"3 array a 1.5 a a@",
+		"3 array a 1 3 a a!",
+		"3 array a 0 a a!",
+		"3 array a a@",
+		"0 0 a@",
+		"3 array a 0 5 a@",
+		"length",
+		"3 length",
+		"3 array a -1 a resize",
+		"3 array a resize",
+		"3 array a 1000000000000000 a resize",
+		"reverse",
+		"5 sort",
+		"3 array a fill",
+		"3 array a a 1 +",
+		"3 array a 1.5 a +",
+	}
+
+	for _, test := range tests {
+		e := New()
+		err := e.Eval(test)
+		if err == nil {
+			t.Fatalf("expected an error evaluating '%s'", test)
+		}
+	}
+}
+
+func TestArrayLimit(t *testing.T) {
+
+	tests := []string{
+		"10 array a",
+		"3 array a 5 a resize",
+		"3 array a 1 , 2 ,",
+	}
+
+	for _, test := range tests {
+		e := New()
+		e.SetLimits(Limits{MaxMemory: 4})
+
+		err := e.Eval(test)
+		if !errors.Is(err, ErrMemoryLimit) {
+			t.Fatalf("%s: expected memory limit, got %v", test, err)
+		}
+	}
+}
+
+func TestGetSetArray(t *testing.T) {
+
+	e := New()
+
+	_, err := e.GetArray("data")
+	if err == nil {
+		t.Fatalf("expected an error for a missing array")
+	}
+
+	err = e.SetArray("data", []float64{3, 1, 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	err = e.Eval("data sort 10 0 data a! 4 data resize")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	out, err := e.GetArray("data")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []float64{10, 2, 3, 0}
+	if len(out) != len(expected) {
+		t.Fatalf("wrong result %v", out)
+	}
+	for i := range out {
+		if out[i] != expected[i] {
+			t.Fatalf("wrong result %v", out)
+		}
+	}
+
+	// Replacing an array keeps the same reference
+	err = e.SetArray("data", []float64{1.5})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	err = e.Eval("0 data a@")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	n, _ := e.Stack.Pop()
+	if n != 1.5 {
+		t.Fatalf("wrong result %f", n)
+	}
+}
@@ -0,0 +1,113 @@
+// This file contains the support for arbitrary-precision integers, and
+// rational numbers, which are backed by golang's math/big package.
+//
+// Literals are written with a suffix, "123n" for an integer and "1/3r"
+// for a rational, and the usual arithmetic and comparison words work
+// upon them - see arithOp, div, and mod.
+
+package eval
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/skx/foth/foth/stack"
+)
+
+// PushBig adds an arbitrary-precision integer to the top of the stack.
+//
+// This is designed to be used by host-applications which embed
+// this library.
+func (e *Eval) PushBig(b *big.Int) {
+	e.Stack.PushCell(stack.BigIntCell(new(big.Int).Set(b)))
+}
+
+// PopBig removes the integer on the top of the stack, and returns it as
+// an arbitrary-precision integer.
+//
+// This is designed to be used by host-applications which embed
+// this library.
+func (e *Eval) PopBig() (*big.Int, error) {
+	c, err := e.Stack.PopCell()
+	if err != nil {
+		return nil, err
+	}
+	if !c.IsInteger() {
+		return nil, fmt.Errorf("%s is not an integer", c)
+	}
+	return new(big.Int).Set(c.Big()), nil
+}
+
+// PushRat adds a rational number to the top of the stack.
+//
+// This is designed to be used by host-applications which embed
+// this library.
+func (e *Eval) PushRat(r *big.Rat) {
+	e.Stack.PushCell(stack.BigRatCell(new(big.Rat).Set(r)))
+}
+
+// PopRat removes the number on the top of the stack, and returns it as
+// a rational number.  Integers are converted, but floating-point numbers
+// are rejected.
+//
+// This is designed to be used by host-applications which embed
+// this library.
+func (e *Eval) PopRat() (*big.Rat, error) {
+	c, err := e.Stack.PopCell()
+	if err != nil {
+		return nil, err
+	}
+	if c.Kind == stack.Float {
+		return nil, fmt.Errorf("%s is not a rational number", c)
+	}
+	return new(big.Rat).Set(c.Rat()), nil
+}
+
+// toBig converts the number on the top of the stack to an
+// arbitrary-precision integer, truncating any fractional part.
+func (e *Eval) toBig() error {
+	c, err := e.Stack.PopCell()
+	if err != nil {
+		return err
+	}
+
+	switch c.Kind {
+	case stack.Int:
+		c = stack.BigIntCell(big.NewInt(c.I))
+	case stack.BigRat:
+		c = stack.BigIntCell(new(big.Int).Quo(c.R.Num(), c.R.Denom()))
+	case stack.Float:
+		if math.IsNaN(c.F) || math.IsInf(c.F, 0) {
+			return fmt.Errorf("cannot convert %s to an integer", c)
+		}
+		b, _ := big.NewFloat(c.F).Int(nil)
+		c = stack.BigIntCell(b)
+	}
+
+	e.Stack.PushCell(c)
+	return nil
+}
+
+// toRat converts the number on the top of the stack to a rational.
+//
+// Floating-point numbers are converted exactly, so 0.1 becomes the
+// fraction closest to it, rather than 1/10.
+func (e *Eval) toRat() error {
+	c, err := e.Stack.PopCell()
+	if err != nil {
+		return err
+	}
+
+	if c.Kind == stack.Float {
+		if math.IsNaN(c.F) || math.IsInf(c.F, 0) {
+			return fmt.Errorf("cannot convert %s to a rational", c)
+		}
+		c = stack.BigRatCell(new(big.Rat).SetFloat64(c.F))
+	} else if c.Kind != stack.BigRat {
+		c = stack.BigRatCell(c.Rat())
+	}
+
+	e.Stack.PushCell(c)
+	return nil
+}
@@ -0,0 +1,160 @@
+package eval
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestBigNumbers(t *testing.T) {
+
+	type TestCase struct {
+		input  string
+		output string
+	}
+
+	tests := []TestCase{
+		{"123456789012345678901234567890n .", "123456789012345678901234567890 "},
+		{"123456789012345678901234567890n 1 + .", "123456789012345678901234567891 "},
+		{"9223372036854775807n 1 + .", "9223372036854775808 "},
+		{"2n 3 * 1n - .", "5 "},
+		{"10n 5 / .", "2 "},
+		{"10n 4 / .", "5/2 "},
+		{"10n 4 mod .", "2 "},
+		{"-7n 2 mod .", "-1 "},
+		{"1/3r .", "1/3 "},
+		{"1/3r 1/3r + 1/3r + .", "1 "},
+		{"1/3r 2 * .", "2/3 "},
+		{"0.1r 0.2r + .", "3/10 "},
+		{"1/3r 1/6r - .", "1/6 "},
+		{"1/2r 1/4r / .", "2 "},
+		{"7/2r 1 mod .", "1/2 "},
+		{"-7/2r 1 mod .", "-1/2 "},
+		{"1/2r 0.5 + .", "1 "},
+		{"1/3r 1/4r > .", "1 "},
+		{"1/2r 2/4r = .", "1 "},
+		{"100000000000000000001n 100000000000000000000n > .", "1 "},
+		{"3n 3 = .", "1 "},
+		{"-5n abs .", "5 "},
+		{"-1/2r abs .", "1/2 "},
+		{"1/2r 1/3r max .", "1/2 "},
+		{"12 >big 1 - .", "11 "},
+		{"12.7 >big .", "12 "},
+		{"7/2r >big .", "3 "},
+		{"3 >rat 4 / .", "3/4 "},
+		{"0.5 >rat .", "1/2 "},
+		{"5n >rat .", "5 "},
+		{"variable x 1/3r x ! x @ 3 * .", "1 "},
+		{": third 1/3r ; third third + .", "2/3 "},
+		{"12n 10 and .", "8 "},
+
+		// integers which overflow are promoted
+		{"9223372036854775807 1 + .", "9223372036854775808 "},
+		{"-9223372036854775808 -1 + .", "-9223372036854775809 "},
+		{"-9223372036854775808 1 - .", "-9223372036854775809 "},
+		{"9223372036854775807 -1 - .", "9223372036854775808 "},
+		{"4611686018427387904 2 * .", "9223372036854775808 "},
+		{"-9223372036854775808 -1 * .", "9223372036854775808 "},
+		{"-1 -9223372036854775808 * .", "9223372036854775808 "},
+		{"-9223372036854775808 -1 / .", "9223372036854775808 "},
+		{"-9223372036854775808 abs .", "9223372036854775808 "},
+		{"9223372036854775807 1 + 1 - .", "9223372036854775807 "},
+		{"-4611686018427387904 2 * .", "-9223372036854775808 "},
+	}
+
+	for _, test := range tests {
+
+		e := New()
+		out := e.CaptureOutput()
+
+		err := e.Eval(test.input)
+		if err != nil {
+			t.Fatalf("unexpected error evaluating '%s': %s", test.input, err.Error())
+		}
+		if out.String() != test.output {
+			t.Fatalf("'%s' gave '%s', not '%s'", test.input, out.String(), test.output)
+		}
+	}
+}
+
+func TestBigErrors(t *testing.T) {
+
+	tests := []string{
+		"1n 0 /",
+		"1/2r 0 /",
+		"1n 0n mod",
+		"1/2r 0 mod",
+		"1/0r",
+		"12xn",
+		">big",
+		">rat",
+		"1.0 0 / >big",
+		"1.0 0 / >rat",
+		"100000000000000000000n 1 and",
+	}
+
+	for _, test := range tests {
+		e := New()
+		err := e.Eval(test)
+		if err == nil {
+			t.Fatalf("expected an error evaluating '%s'", test)
+		}
+	}
+}
+
+func TestBigHost(t *testing.T) {
+
+	e := New()
+
+	b, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	e.PushBig(b)
+	e.PushRat(big.NewRat(1, 3))
+
+	err := e.Eval("* 2 *")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	r, err := e.PopRat()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if r.RatString() != "82304526008230452600823045260" {
+		t.Fatalf("unexpected result: %s", r.RatString())
+	}
+
+	// Integers can be popped as rationals, but not the reverse.
+	e.PushBig(b)
+	r, err = e.PopRat()
+	if err != nil || !r.IsInt() {
+		t.Fatalf("unexpected result: %v %v", r, err)
+	}
+
+	e.PushRat(big.NewRat(1, 3))
+	_, err = e.PopBig()
+	if err == nil {
+		t.Fatalf("expected error popping a rational as an integer")
+	}
+
+	e.Stack.PushInt(3)
+	out, err := e.PopBig()
+	if err != nil || out.Int64() != 3 {
+		t.Fatalf("unexpected result: %v %v", out, err)
+	}
+
+	// Floats aren't rationals
+	e.Stack.Push(1.5)
+	_, err = e.PopRat()
+	if err == nil {
+		t.Fatalf("expected error popping a float as a rational")
+	}
+
+	// empty stack
+	_, err = e.PopBig()
+	if err == nil {
+		t.Fatalf("expected error with empty stack")
+	}
+	_, err = e.PopRat()
+	if err == nil {
+		t.Fatalf("expected error with empty stack")
+	}
+}
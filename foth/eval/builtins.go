@@ -3,35 +3,252 @@
 // That means the implementation for "+", "-", "/", "*", and "print".
 //
 // We've added `emit` here, to output the value at the top of the stack
-// as an ASCII character, as well as "do" (nop) and "loop".
+// as a character, as well as "do" (nop) and "loop".
 
 package eval
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"math"
+	"math/big"
 	"sort"
 	"strings"
+	"unicode/utf8"
+
+	"github.com/skx/foth/foth/stack"
 )
 
-func (e *Eval) binOp(op func(float64, float64) float64) func() error {
+// binOp pops two cells from the stack, and pushes the result of calling
+// the given function upon them.
+//
+// Note that the top-most cell is the first argument.
+func (e *Eval) binOp(op func(stack.Cell, stack.Cell) (stack.Cell, error)) func() error {
 	return func() error {
-		a, err := e.Stack.Pop()
+		a, err := e.Stack.PopCell()
+		if err != nil {
+			return err
+		}
+
+		b, err := e.Stack.PopCell()
 		if err != nil {
 			return err
 		}
 
-		b, err := e.Stack.Pop()
+		res, err := op(a, b)
 		if err != nil {
 			return err
 		}
+		e.Stack.PushCell(res)
+		return nil
+	}
+}
+
+// arithOp returns a binOp which uses exact integer arithmetic if both
+// cells are integers, and floating-point arithmetic if either is a
+// floating-point number.
+//
+// Otherwise arbitrary-precision arithmetic is used, via bop or rop, which
+// are called with the cells in the order they were pushed - i.e. they
+// are expected to be method-expressions such as `(*big.Int).Sub`.
+//
+// The integer operation reports whether its result fits within an int64,
+// if it doesn't the arbitrary-precision operation is used instead.
+func (e *Eval) arithOp(iop func(int64, int64) (int64, bool), fop func(float64, float64) float64,
+	bop func(*big.Int, *big.Int, *big.Int) *big.Int, rop func(*big.Rat, *big.Rat, *big.Rat) *big.Rat) func() error {
+	return e.binOp(func(n stack.Cell, m stack.Cell) (stack.Cell, error) {
+		switch {
+		case n.IsReference() || m.IsReference():
+			return stack.Cell{}, fmt.Errorf("cannot perform arithmetic upon an array, or map")
+		case n.Kind == stack.Int && m.Kind == stack.Int:
+			if r, ok := iop(n.I, m.I); ok {
+				return stack.IntCell(r), nil
+			}
+			return stack.BigIntCell(bop(new(big.Int), m.Big(), n.Big())), nil
+		case n.Kind == stack.Float || m.Kind == stack.Float:
+			return stack.FloatCell(fop(n.Float(), m.Float())), nil
+		case n.IsInteger() && m.IsInteger():
+			return stack.BigIntCell(bop(new(big.Int), m.Big(), n.Big())), nil
+		}
+		return stack.BigRatCell(rop(new(big.Rat), m.Rat(), n.Rat())), nil
+	})
+}
+
+// compareOp returns a binOp which compares two cells, pushing 1 if the
+// result of the comparison passes the given test, and 0 otherwise.
+func (e *Eval) compareOp(test func(int) bool) func() error {
+	return e.binOp(func(n stack.Cell, m stack.Cell) (stack.Cell, error) {
+		if test(stack.Compare(m, n)) {
+			return stack.IntCell(1), nil
+		}
+		return stack.IntCell(0), nil
+	})
+}
+
+// intOp returns a binOp which operates upon integers, failing if either
+// cell holds a number with a fractional part.
+func (e *Eval) intOp(op func(int64, int64) int64) func() error {
+	return e.binOp(func(n stack.Cell, m stack.Cell) (stack.Cell, error) {
+		a, err := toInt(n)
+		if err != nil {
+			return stack.Cell{}, err
+		}
+		b, err := toInt(m)
+		if err != nil {
+			return stack.Cell{}, err
+		}
+		return stack.IntCell(op(a, b)), nil
+	})
+}
+
+// toInt returns the value of the given cell as an integer, failing if
+// it holds a number which isn't a whole number, or which is too large.
+func toInt(c stack.Cell) (int64, error) {
+	switch c.Kind {
+	case stack.Int:
+		return c.I, nil
+	case stack.BigInt:
+		if c.B.IsInt64() {
+			return c.B.Int64(), nil
+		}
+	case stack.BigRat:
+		if c.R.IsInt() && c.R.Num().IsInt64() {
+			return c.R.Num().Int64(), nil
+		}
+	case stack.Float:
+		if c.F == math.Trunc(c.F) && c.F >= math.MinInt64 && c.F < math.MaxInt64 {
+			return int64(c.F), nil
+		}
+	}
+	return 0, fmt.Errorf("%s is not an integer", c)
+}
+
+// shiftLeft shifts x left by n bits, filling with zeros.  Negative
+// shifts move bits to the right instead.
+func shiftLeft(x int64, n int64) int64 {
+	switch {
+	case n >= 64 || n <= -64:
+		return 0
+	case n < 0:
+		return int64(uint64(x) >> uint64(-n))
+	}
+	return int64(uint64(x) << uint64(n))
+}
 
-		e.Stack.Push(op(a, b))
+// shiftRight shifts x right by n bits, filling with zeros.  Negative
+// shifts move bits to the left instead.
+func shiftRight(x int64, n int64) int64 {
+	switch {
+	case n >= 64 || n <= -64:
+		return 0
+	case n < 0:
+		return int64(uint64(x) << uint64(-n))
+	}
+	return int64(uint64(x) >> uint64(n))
+}
+
+// abort resets the interpreter, and terminates execution.
+func (e *Eval) abort() error {
+	e.Reset()
+	return &AbortError{}
+}
+
+// abortIf is the implementation of `abort" ... "`, it pops a flag from
+// the stack and aborts with the given message if it is non-zero.
+func (e *Eval) abortIf(msg string) error {
+	flag, err := e.Stack.Pop()
+	if err != nil {
+		return err
+	}
+	if flag == 0 {
 		return nil
 	}
+
+	// The message is delimited by a single space, as with `."`
+	e.Reset()
+	return &AbortError{Message: strings.TrimPrefix(msg, " ")}
+}
+
+// accept reads a line of input, and pushes it as a string.
+//
+// At the end of our input an empty string is returned, `key?` may
+// be used to test for that beforehand.
+func (e *Eval) accept() error {
+	line, err := e.readLine()
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	return e.pushString(line)
 }
 
 func (e *Eval) add() error {
-	return e.binOp(func(n float64, m float64) float64 { return n + m })()
+	return e.arithOp(
+		func(n int64, m int64) (int64, bool) {
+			r := m + n
+			return r, (r > m) == (n > 0)
+		},
+		func(n float64, m float64) float64 { return m + n },
+		(*big.Int).Add, (*big.Rat).Add)()
+}
+
+// arshift shifts a number right, copying the sign-bit.
+func (e *Eval) arshift() error {
+	return e.intOp(func(n int64, m int64) int64 {
+		if n < 0 {
+			return shiftLeft(m, -n)
+		}
+		if n >= 64 {
+			n = 63
+		}
+		return m >> uint64(n)
+	})()
+}
+
+// bemit outputs a single byte, unlike emit which outputs a character.
+func (e *Eval) bemit() error {
+	a, err := e.Stack.PopCell()
+	if err != nil {
+		return err
+	}
+	c := a.Int()
+	if c < 0 || c > 0xff {
+		return fmt.Errorf("invalid byte %s", a)
+	}
+	e.printString(string([]byte{byte(c)}))
+	return nil
+}
+
+func (e *Eval) binary() error {
+	return e.setBase(2)
+}
+
+func (e *Eval) bitAnd() error {
+	return e.intOp(func(n int64, m int64) int64 { return m & n })()
+}
+
+func (e *Eval) bitOr() error {
+	return e.intOp(func(n int64, m int64) int64 { return m | n })()
+}
+
+func (e *Eval) bitXor() error {
+	return e.intOp(func(n int64, m int64) int64 { return m ^ n })()
+}
+
+// bkey reads a single byte of input, unlike key which reads a character,
+// pushing -1 on EOF.
+func (e *Eval) bkey() error {
+	c, err := e.input().ReadByte()
+	if err == io.EOF {
+		e.Stack.PushInt(-1)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	e.Stack.PushInt(int64(c))
+	return nil
 }
 
 func (e *Eval) clearStack() error {
@@ -58,15 +275,76 @@ func (e *Eval) debugSet() error {
 
 func (e *Eval) debugp() error {
 	if e.debug {
-		e.Stack.Push(1)
+		e.Stack.PushInt(1)
 	} else {
-		e.Stack.Push(0)
+		e.Stack.PushInt(0)
 	}
 	return nil
 }
 
+func (e *Eval) decimal() error {
+	return e.setBase(10)
+}
+
+// dot outputs the number on the top of the stack, followed by a space.
+//
+// See SetDotNewline to output a newline instead.
+func (e *Eval) dot() error {
+	n, err := e.Stack.PopCell()
+	if err != nil {
+		return err
+	}
+	e.printNumber(n)
+	e.dotSeparator()
+	return nil
+}
+
+// dotSeparator outputs whatever follows a number printed by `.`, or
+// a similar word.
+func (e *Eval) dotSeparator() {
+	if e.dotNewline {
+		e.printString("\n")
+	} else {
+		e.printString(" ")
+	}
+}
+
+// div divides two numbers.
+//
+// Dividing one integer by another gives an integer if the result is
+// exact, and a floating-point number otherwise - unless either integer
+// is an arbitrary-precision one, in which case the result is rational.
 func (e *Eval) div() error {
-	return e.binOp(func(n float64, m float64) float64 { return m / n })()
+	return e.binOp(func(n stack.Cell, m stack.Cell) (stack.Cell, error) {
+		if n.Kind == stack.Float || m.Kind == stack.Float {
+			return stack.FloatCell(m.Float() / n.Float()), nil
+		}
+
+		if n.Kind == stack.Int && m.Kind == stack.Int {
+			if n.I == 0 {
+				return stack.Cell{}, fmt.Errorf("division by zero")
+			}
+			if m.I == math.MinInt64 && n.I == -1 {
+				return stack.BigIntCell(new(big.Int).Neg(m.Big())), nil
+			}
+			if m.I%n.I == 0 {
+				return stack.IntCell(m.I / n.I), nil
+			}
+			return stack.FloatCell(m.Float() / n.Float()), nil
+		}
+
+		if n.Rat().Sign() == 0 {
+			return stack.Cell{}, fmt.Errorf("division by zero")
+		}
+
+		if n.IsInteger() && m.IsInteger() {
+			q, r := new(big.Int).QuoRem(m.Big(), n.Big(), new(big.Int))
+			if r.Sign() == 0 {
+				return stack.BigIntCell(q), nil
+			}
+		}
+		return stack.BigRatCell(new(big.Rat).Quo(m.Rat(), n.Rat())), nil
+	})()
 }
 
 func (e *Eval) drop() error {
@@ -80,88 +358,146 @@ func (e *Eval) dump() error {
 		return err
 	}
 
-	e.dumpWord(int(a))
+	str, err := e.dumpWord(int(a))
+	if err != nil {
+		e.errorf("Invalid index\n")
+		return nil
+	}
+	e.printString(str)
 	return nil
 }
 
 func (e *Eval) dup() error {
-	a, err := e.Stack.Pop()
+	a, err := e.Stack.PopCell()
 	if err != nil {
 		return err
 	}
-	e.Stack.Push(a)
-	e.Stack.Push(a)
+	e.Stack.PushCell(a)
+	e.Stack.PushCell(a)
 
 	return nil
 }
 
+// emit outputs the character with the code on the top of the stack.
 func (e *Eval) emit() error {
-	a, err := e.Stack.Pop()
+	a, err := e.Stack.PopCell()
 	if err != nil {
 		return err
 	}
-	e.printString(string(rune(a)))
+	c := a.Int()
+	if c < 0 || c > utf8.MaxRune || !utf8.ValidRune(rune(c)) {
+		return fmt.Errorf("invalid character code %s", a)
+	}
+	e.printString(string(rune(c)))
 	return nil
 }
 
 func (e *Eval) eq() error {
-	return e.binOp(func(n float64, m float64) float64 {
-		if m == n {
-			return 1
-		}
-		return 0
-	})()
+	return e.compareOp(func(c int) bool { return c == 0 })()
 }
 
+// floatToInt moves the number on the top of the floating-point stack to
+// the stack, converting it to an integer by truncating any fractional part.
+func (e *Eval) floatToInt() error {
+	a, err := e.popFloat()
+	if err != nil {
+		return err
+	}
+	if a.Kind == stack.Float && (math.IsNaN(a.F) || math.IsInf(a.F, 0)) {
+		return fmt.Errorf("cannot convert %s to an integer", a)
+	}
+	e.Stack.PushInt(a.Int())
+	return nil
+}
+
+// getVar pushes the value at the given address.
 func (e *Eval) getVar() error {
 
-	offset, err := e.Stack.Pop()
+	addr, err := e.popAddr()
 	if err != nil {
 		return err
 	}
-	val := e.vars[int(offset)]
-	e.Stack.Push(val.Value)
+	e.Stack.PushCell(e.memory[addr])
 	return nil
 }
 
 func (e *Eval) gt() error {
-	return e.binOp(func(n float64, m float64) float64 {
-		if m > n {
-			return 1
-		}
-		return 0
-	})()
+	return e.compareOp(func(c int) bool { return c > 0 })()
 }
 
 func (e *Eval) gtEq() error {
-	return e.binOp(func(n float64, m float64) float64 {
-		if m >= n {
-			return 1
-		}
-		return 0
-	})()
+	return e.compareOp(func(c int) bool { return c >= 0 })()
+}
+
+func (e *Eval) hex() error {
+	return e.setBase(16)
 }
 
 func (e *Eval) i() error {
 	if len(e.loops) > 0 {
 		i := e.loops[len(e.loops)-1].Current
-		e.Stack.Push(float64(i))
+		e.Stack.PushInt(int64(i))
 		return nil
 	}
 	return fmt.Errorf("you cannot access 'i' outside a loop-body")
 }
 
+// invert flips each bit of a number.
+//
+// See `not` for the logical equivalent.
 func (e *Eval) invert() error {
-	v, err := e.Stack.Pop()
+	v, err := e.Stack.PopCell()
 	if err != nil {
 		return err
 	}
-	if v == 0 {
-		e.Stack.Push(1)
-	} else {
-		e.Stack.Push(0)
+	i, err := toInt(v)
+	if err != nil {
+		return err
 	}
+	e.Stack.PushInt(^i)
+	return nil
+}
 
+// intToFloat moves the number on the top of the stack to the floating-point
+// stack, converting it to a floating-point number.
+func (e *Eval) intToFloat() error {
+	a, err := e.Stack.PopCell()
+	if err != nil {
+		return err
+	}
+	if a.IsReference() {
+		return fmt.Errorf("%s is not a number", a)
+	}
+	e.FStack.Push(a.Float())
+	return nil
+}
+
+// key reads a single character of input, and pushes its value.
+//
+// At the end of our input -1 is returned.
+func (e *Eval) key() error {
+	c, _, err := e.input().ReadRune()
+	if err == io.EOF {
+		e.Stack.PushInt(-1)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	e.Stack.PushInt(int64(c))
+	return nil
+}
+
+// keyp pushes 1 if there is input available to read, and 0 otherwise.
+//
+// NOTE: If reading from a terminal this will wait for input.
+func (e *Eval) keyp() error {
+	_, err := e.input().Peek(1)
+	if err != nil {
+		e.Stack.PushInt(0)
+	} else {
+		e.Stack.PushInt(1)
+	}
 	return nil
 }
 
@@ -169,83 +505,154 @@ func (e *Eval) loop() error {
 	return nil
 }
 
+// lshift shifts a number left.
+func (e *Eval) lshift() error {
+	return e.intOp(func(n int64, m int64) int64 { return shiftLeft(m, n) })()
+}
+
 func (e *Eval) lt() error {
-	return e.binOp(func(n float64, m float64) float64 {
-		if m < n {
-			return 1
-		}
-		return 0
-	})()
+	return e.compareOp(func(c int) bool { return c < 0 })()
 }
 
 func (e *Eval) ltEq() error {
-	return e.binOp(func(n float64, m float64) float64 {
-		if m <= n {
-			return 1
-		}
-		return 0
-	})()
+	return e.compareOp(func(c int) bool { return c <= 0 })()
 }
 
 func (e *Eval) max() error {
-	return e.binOp(func(n float64, m float64) float64 {
-		if m > n {
-			return m
+	return e.binOp(func(n stack.Cell, m stack.Cell) (stack.Cell, error) {
+		if stack.Compare(m, n) > 0 {
+			return m, nil
 		}
-		return n
+		return n, nil
 	})()
 }
 
 func (e *Eval) min() error {
-	return e.binOp(func(n float64, m float64) float64 {
-		if m < n {
-			return m
+	return e.binOp(func(n stack.Cell, m stack.Cell) (stack.Cell, error) {
+		if stack.Compare(m, n) < 0 {
+			return m, nil
 		}
-		return n
+		return n, nil
 	})()
 }
 
 func (e *Eval) m() error {
 	if len(e.loops) > 0 {
 		m := e.loops[len(e.loops)-1].Max
-		e.Stack.Push(float64(m))
+		e.Stack.PushInt(int64(m))
 		return nil
 	}
 
 	return fmt.Errorf("you cannot access 'm' outside a loop-body")
 }
 
+// mod returns the remainder of dividing two numbers.
+//
+// The result has the same sign as the dividend, and for floating-point
+// and rational numbers includes any fractional part.
 func (e *Eval) mod() error {
-	return e.binOp(func(n float64, m float64) float64 {
-		return float64(int(m) % int(n))
+	return e.binOp(func(n stack.Cell, m stack.Cell) (stack.Cell, error) {
+		if n.Kind == stack.Float || m.Kind == stack.Float {
+			return stack.FloatCell(math.Mod(m.Float(), n.Float())), nil
+		}
+
+		if n.Kind == stack.Int && m.Kind == stack.Int {
+			if n.I == 0 {
+				return stack.Cell{}, fmt.Errorf("division by zero")
+			}
+			return stack.IntCell(m.I % n.I), nil
+		}
+
+		if n.Rat().Sign() == 0 {
+			return stack.Cell{}, fmt.Errorf("division by zero")
+		}
+
+		if n.IsInteger() && m.IsInteger() {
+			return stack.BigIntCell(new(big.Int).Rem(m.Big(), n.Big())), nil
+		}
+
+		// m - n * trunc(m / n)
+		q := new(big.Rat).Quo(m.Rat(), n.Rat())
+		t := new(big.Int).Quo(q.Num(), q.Denom())
+		r := new(big.Rat).Mul(n.Rat(), new(big.Rat).SetInt(t))
+		return stack.BigRatCell(r.Sub(m.Rat(), r)), nil
 	})()
 }
 
 func (e *Eval) mul() error {
-	return e.binOp(func(n float64, m float64) float64 { return m * n })()
+	return e.arithOp(
+		func(n int64, m int64) (int64, bool) {
+			if m == 0 || n == 0 {
+				return 0, true
+			}
+			r := m * n
+			return r, r/n == m && !(n == -1 && m == math.MinInt64)
+		},
+		func(n float64, m float64) float64 { return m * n },
+		(*big.Int).Mul, (*big.Rat).Mul)()
 }
 
 func (e *Eval) nop() error {
 	return nil
 }
 
+// not returns 1 if the value is zero, and 0 otherwise.
+//
+// See `invert` for the bitwise equivalent.
+func (e *Eval) not() error {
+	v, err := e.Stack.Pop()
+	if err != nil {
+		return err
+	}
+	if v == 0 {
+		e.Stack.PushInt(1)
+	} else {
+		e.Stack.PushInt(0)
+	}
+
+	return nil
+}
+
+// numberInput reads a line of input, and pushes the number it contains.
+func (e *Eval) numberInput() error {
+	line, err := e.readLine()
+	if err == io.EOF {
+		return fmt.Errorf("end of input reading number")
+	}
+	if err != nil {
+		return err
+	}
+
+	line = strings.TrimSpace(line)
+	n, err := e.parseNumber(line)
+	if err != nil {
+		return fmt.Errorf("failed to convert %s to number", line)
+	}
+	e.Stack.PushCell(n)
+	return nil
+}
+
+func (e *Eval) octal() error {
+	return e.setBase(8)
+}
+
 func (e *Eval) over() error {
-	a, err := e.Stack.Pop()
+	a, err := e.Stack.PopCell()
 	if err != nil {
 		return err
 	}
-	b, err := e.Stack.Pop()
+	b, err := e.Stack.PopCell()
 	if err != nil {
 		return err
 	}
 
-	e.Stack.Push(b)
-	e.Stack.Push(a)
-	e.Stack.Push(b)
+	e.Stack.PushCell(b)
+	e.Stack.PushCell(a)
+	e.Stack.PushCell(b)
 	return nil
 }
 func (e *Eval) print() error {
-	n, err := e.Stack.Pop()
+	n, err := e.Stack.PopCell()
 	if err != nil {
 		return err
 	}
@@ -254,16 +661,56 @@ func (e *Eval) print() error {
 	return nil
 }
 
+func (e *Eval) profileReport() error {
+	var out bytes.Buffer
+	err := e.WriteProfileReport(&out)
+	if err != nil {
+		return err
+	}
+	e.printString(out.String())
+	return nil
+}
+
+func (e *Eval) profileSet() error {
+	v, err := e.Stack.Pop()
+	if err != nil {
+		return err
+	}
+	e.SetProfiling(v != 0)
+	return nil
+}
+
+func (e *Eval) profilep() error {
+	if e.profiling {
+		e.Stack.PushInt(1)
+	} else {
+		e.Stack.PushInt(0)
+	}
+	return nil
+}
+
+// rshift shifts a number right, filling with zeros.
+func (e *Eval) rshift() error {
+	return e.intOp(func(n int64, m int64) int64 { return shiftRight(m, n) })()
+}
+
+// setBase changes the number-base used for parsing and printing numbers.
+func (e *Eval) setBase(base int64) error {
+	e.memory[e.vars[e.baseVar].Addr] = stack.IntCell(base)
+	return nil
+}
+
+// setVar stores a value at the given address.
 func (e *Eval) setVar() error {
-	offset, err := e.Stack.Pop()
+	addr, err := e.popAddr()
 	if err != nil {
 		return err
 	}
-	value, err2 := e.Stack.Pop()
+	value, err2 := e.Stack.PopCell()
 	if err2 != nil {
 		return err2
 	}
-	e.vars[int(offset)].Value = value
+	e.store(addr, value)
 	return nil
 }
 
@@ -273,7 +720,7 @@ func (e *Eval) stackDump() error {
 
 	c := 0
 	for c < l {
-		e.printNumber(e.Stack.At(c))
+		e.printNumber(e.Stack.AtCell(c))
 		e.printString(" ")
 		c++
 	}
@@ -292,71 +739,107 @@ func (e *Eval) startDefinition() error {
 
 // strings
 func (e *Eval) stringCount() error {
-	// Return the number of strings we've seen
-	e.Stack.Push(float64(len(e.strings)))
+	// Return the number of strings which are in use
+	e.Stack.PushInt(int64(e.strings.live))
 	return nil
 }
 
-// strlen
-func (e *Eval) strlen() error {
-	addr, err := e.Stack.Pop()
+// strblen returns the length of a string in bytes, rather than
+// characters.
+func (e *Eval) strblen() error {
+	str, err := e.popString()
 	if err != nil {
 		return err
 	}
 
-	i := int(addr)
+	e.Stack.PushInt(int64(len(str)))
+	return nil
+}
 
-	if i < len(e.strings) {
-		str := e.strings[i]
-		e.Stack.Push(float64(len(str)))
-		return nil
+// strlen returns the length of a string, in characters.
+func (e *Eval) strlen() error {
+	str, err := e.popString()
+	if err != nil {
+		return err
 	}
 
-	return fmt.Errorf("invalid stack offset for string reference")
-
+	e.Stack.PushInt(int64(utf8.RuneCountInString(str)))
+	return nil
 }
 
 // strprn - string printing
 func (e *Eval) strprn() error {
-	addr, err := e.Stack.Pop()
+	str, err := e.popString()
 	if err != nil {
 		return err
 	}
 
-	i := int(addr)
-
-	if i < len(e.strings) {
-		str := e.strings[i]
-		e.printString(str)
-		return nil
-	}
-
-	return fmt.Errorf("invalid stack offset for string reference")
+	e.printString(str)
+	return nil
 }
 
 func (e *Eval) sub() error {
-	return e.binOp(func(n float64, m float64) float64 { return m - n })()
+	return e.arithOp(
+		func(n int64, m int64) (int64, bool) {
+			r := m - n
+			return r, (r < m) == (n > 0)
+		},
+		func(n float64, m float64) float64 { return m - n },
+		(*big.Int).Sub, (*big.Rat).Sub)()
 }
 
 func (e *Eval) swap() error {
-	var a, b float64
+	var a, b stack.Cell
 	var err error
-	b, err = e.Stack.Pop()
+	b, err = e.Stack.PopCell()
 	if err != nil {
 		return err
 	}
-	a, err = e.Stack.Pop()
+	a, err = e.Stack.PopCell()
 	if err != nil {
 		return err
 	}
-	e.Stack.Push(b)
-	e.Stack.Push(a)
+	e.Stack.PushCell(b)
+	e.Stack.PushCell(a)
 
 	return nil
 }
 
+// twoDiv halves a number, by shifting it right one bit.
+func (e *Eval) twoDiv() error {
+	v, err := e.Stack.PopCell()
+	if err != nil {
+		return err
+	}
+	i, err := toInt(v)
+	if err != nil {
+		return err
+	}
+	e.Stack.PushInt(i >> 1)
+	return nil
+}
+
+// twoMul doubles a number, by shifting it left one bit.
+func (e *Eval) twoMul() error {
+	v, err := e.Stack.PopCell()
+	if err != nil {
+		return err
+	}
+	i, err := toInt(v)
+	if err != nil {
+		return err
+	}
+	e.Stack.PushInt(i << 1)
+	return nil
+}
+
 func (e *Eval) variable() error {
-	e.defining = true
+	e.defining = func(name string) error {
+		if e.debug {
+			e.debugf("defining variable %s\n", name)
+		}
+		return e.addVariable(name, stack.IntCell(0))
+	}
 	return nil
 }
 
@@ -374,7 +857,7 @@ func (e *Eval) words() error {
 	}
 
 	sort.Strings(known)
-	fmt.Printf("%s\n", strings.Join(known, " "))
+	e.printString(strings.Join(known, " ") + "\n")
 
 	return nil
 }
@@ -392,6 +875,6 @@ func (e *Eval) wordLen() error {
 		}
 	}
 
-	e.Stack.Push(float64(len(known)))
+	e.Stack.PushInt(int64(len(known)))
 	return nil
 }
@@ -1,10 +1,49 @@
 package eval
 
 import (
+	"math"
 	"os"
+	"strings"
 	"testing"
+
+	"github.com/skx/foth/foth/stack"
 )
 
+func TestAbortBuiltin(t *testing.T) {
+
+	e := New()
+	e.Stack.Push(3)
+
+	err := e.abort()
+	if err == nil {
+		t.Fatalf("expected error, got none")
+	}
+	if err.Error() != "aborted" {
+		t.Fatalf("got an error, but the wrong one: %s", err.Error())
+	}
+	if !e.Stack.IsEmpty() {
+		t.Fatalf("stack should be empty now")
+	}
+}
+
+func TestAccept(t *testing.T) {
+
+	e := New()
+	e.SetReader(strings.NewReader("first line\r\nlast"))
+
+	expected := []string{"first line", "last", ""}
+	for _, str := range expected {
+		err := e.accept()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		idx, _ := e.Stack.Pop()
+		if e.strings.values[int(idx)] != str {
+			t.Fatalf("expected '%s', got '%s'", str, e.strings.values[int(idx)])
+		}
+	}
+}
+
 func TestAdd(t *testing.T) {
 
 	e := New()
@@ -36,6 +75,109 @@ func TestAdd(t *testing.T) {
 	}
 }
 
+func TestBitwise(t *testing.T) {
+
+	type TestCase struct {
+		input  string
+		result int64
+	}
+
+	tests := []TestCase{
+		{"12 10 and", 8},
+		{"12 10 or", 14},
+		{"12 10 xor", 6},
+		{"0 invert", -1},
+		{"1 4 lshift", 16},
+		{"16 4 rshift", 1},
+		{"16 -4 lshift", 1},
+		{"1 -4 rshift", 16},
+		{"1 64 lshift", 0},
+		{"-1 63 rshift", 1},
+		{"-1 64 rshift", 0},
+		{"-16 2 arshift", -4},
+		{"-1 64 arshift", -1},
+		{"1 -3 arshift", 8},
+		{"1 -9223372036854775808 lshift", 0},
+		{"1 -9223372036854775808 rshift", 0},
+		{"1 -9223372036854775808 arshift", 0},
+		{"1 9223372036854775807 lshift", 0},
+		{"-1 9223372036854775807 arshift", -1},
+		{"1 -64 lshift", 0},
+		{"1 -64 rshift", 0},
+		{"1 -63 rshift", -9223372036854775808},
+		{"5 2*", 10},
+		{"-5 2/", -3},
+		{"7 2/", 3},
+		{"12.0 10 and", 8},
+		{"0 0=", 1},
+		{"3 0=", 0},
+		{"0 not", 1},
+		{"3 not", 0},
+	}
+
+	for _, test := range tests {
+		e := New()
+		err := e.Eval(test.input)
+		if err != nil {
+			t.Fatalf("unexpected error evaluating '%s': %s", test.input, err.Error())
+		}
+		out, _ := e.Stack.PopCell()
+		if out != stack.IntCell(test.result) {
+			t.Fatalf("'%s' gave %v, not %d", test.input, out, test.result)
+		}
+	}
+
+	// Fractions, and missing arguments, are errors
+	errs := []string{"1.5 1 and", "1 1.5 or", "1 xor", "2.5 2*", "2.5 2/", "2*", "2/", "1e30 1 lshift"}
+	for _, test := range errs {
+		e := New()
+		err := e.Eval(test)
+		if err == nil {
+			t.Fatalf("expected error evaluating '%s'", test)
+		}
+	}
+}
+
+func TestByteIO(t *testing.T) {
+
+	e := New()
+	if e.bemit() == nil {
+		t.Fatalf("expected error, got none")
+	}
+
+	// bytes are output as-is, so two make up a multi-byte character
+	out := e.CaptureOutput()
+	for _, b := range []byte("é") {
+		e.Stack.PushInt(int64(b))
+		if e.bemit() != nil {
+			t.Fatalf("unexpected error")
+		}
+	}
+	if out.String() != "é" {
+		t.Fatalf("wrong output '%s'", out.String())
+	}
+
+	for _, n := range []int64{-1, 256} {
+		e.Stack.PushInt(n)
+		if e.bemit() == nil {
+			t.Fatalf("expected error emitting %d", n)
+		}
+	}
+
+	// bkey reads the bytes of a character one at a time
+	e.SetReader(strings.NewReader("aé"))
+	expected := []float64{'a', 0xc3, 0xa9, -1}
+	for _, n := range expected {
+		if e.bkey() != nil {
+			t.Fatalf("unexpected error")
+		}
+		got, _ := e.Stack.Pop()
+		if got != n {
+			t.Fatalf("expected %f, got %f", n, got)
+		}
+	}
+}
+
 func TestDebug(t *testing.T) {
 
 	e := New()
@@ -133,6 +275,43 @@ func TestDiv(t *testing.T) {
 	}
 }
 
+func TestDivInt(t *testing.T) {
+
+	e := New()
+
+	// exact division stays an integer
+	e.Stack.PushInt(9)
+	e.Stack.PushInt(3)
+	err := e.div()
+	if err != nil {
+		t.Fatalf("expected no error, but got one")
+	}
+	x, _ := e.Stack.PopCell()
+	if x != stack.IntCell(3) {
+		t.Fatalf("wrong result for div: %v", x)
+	}
+
+	// inexact division becomes a float
+	e.Stack.PushInt(5)
+	e.Stack.PushInt(4)
+	err = e.div()
+	if err != nil {
+		t.Fatalf("expected no error, but got one")
+	}
+	x, _ = e.Stack.PopCell()
+	if x != stack.FloatCell(1.25) {
+		t.Fatalf("wrong result for div: %v", x)
+	}
+
+	// division by zero
+	e.Stack.PushInt(5)
+	e.Stack.PushInt(0)
+	err = e.div()
+	if err == nil {
+		t.Fatalf("expected error dividing by zero")
+	}
+}
+
 func TestDrop(t *testing.T) {
 
 	e := New()
@@ -219,6 +398,24 @@ func TestEmit(t *testing.T) {
 	if e.emit() != nil {
 		t.Fatalf("unexpected error")
 	}
+
+	// characters may be multi-byte
+	out := e.CaptureOutput()
+	e.Stack.PushInt('é')
+	if e.emit() != nil {
+		t.Fatalf("unexpected error")
+	}
+	if out.String() != "é" {
+		t.Fatalf("wrong output '%s'", out.String())
+	}
+
+	// but must be valid
+	for _, n := range []int64{-1, 0xD800, 0x110000} {
+		e.Stack.PushInt(n)
+		if e.emit() == nil {
+			t.Fatalf("expected error emitting %d", n)
+		}
+	}
 }
 
 func TestEq(t *testing.T) {
@@ -267,6 +464,34 @@ func TestEq(t *testing.T) {
 	}
 }
 
+func TestFloatToInt(t *testing.T) {
+
+	e := New()
+
+	// empty stack
+	err := e.floatToInt()
+	if err == nil {
+		t.Fatalf("expected error with empty stack")
+	}
+
+	e.Stack.Push(-3.7)
+	err = e.floatToInt()
+	if err != nil {
+		t.Fatalf("expected no error, but got one")
+	}
+	x, _ := e.Stack.PopCell()
+	if x != stack.IntCell(-3) {
+		t.Fatalf("wrong result for f>s: %v", x)
+	}
+
+	// NaN can't be converted
+	e.Stack.Push(math.NaN())
+	err = e.floatToInt()
+	if err == nil {
+		t.Fatalf("expected error converting NaN")
+	}
+}
+
 func TestGetVar(t *testing.T) {
 
 	e := New()
@@ -280,8 +505,8 @@ func TestGetVar(t *testing.T) {
 		t.Fatalf("expected error with empty stack")
 	}
 
-	// get the first variable.
-	e.Stack.Push(0)
+	// get the variable.
+	e.Stack.PushInt(int64(e.vars[e.findVariable("foo")].Addr))
 	err = e.getVar()
 	if err != nil {
 		t.Fatalf("unexpected error")
@@ -391,6 +616,27 @@ func TestGtEq(t *testing.T) {
 	}
 }
 
+func TestIntToFloat(t *testing.T) {
+
+	e := New()
+
+	// empty stack
+	err := e.intToFloat()
+	if err == nil {
+		t.Fatalf("expected error with empty stack")
+	}
+
+	e.Stack.PushInt(3)
+	err = e.intToFloat()
+	if err != nil {
+		t.Fatalf("expected no error, but got one")
+	}
+	x, _ := e.FStack.PopCell()
+	if x != stack.FloatCell(3) {
+		t.Fatalf("wrong result for s>f: %v", x)
+	}
+}
+
 func TestInvert(t *testing.T) {
 
 	e := New()
@@ -401,28 +647,57 @@ func TestInvert(t *testing.T) {
 		t.Fatalf("expected error with empty stack")
 	}
 
-	// 0 -> 1
-	e.Stack.Push(0)
-	e.invert()
-	out, err2 := e.Stack.Pop()
-	if err2 != nil {
-		t.Errorf("unexpected error")
+	// 0 -> -1
+	e.Stack.PushInt(0)
+	err = e.invert()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
 	}
-	if out != 1 {
-		t.Errorf("unexpected result")
+	out, _ := e.Stack.PopCell()
+	if out != stack.IntCell(-1) {
+		t.Errorf("unexpected result: %v", out)
 	}
 
-	// 10 -> 0
+	// 10 -> -11
 	e.Stack.Push(10)
-	e.invert()
-	out, err2 = e.Stack.Pop()
-	if err2 != nil {
-		t.Errorf("unexpected error")
+	err = e.invert()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
 	}
-	if out != 0 {
-		t.Errorf("unexpected result")
+	out, _ = e.Stack.PopCell()
+	if out != stack.IntCell(-11) {
+		t.Errorf("unexpected result: %v", out)
+	}
+
+	// fractions can't be inverted
+	e.Stack.Push(1.5)
+	err = e.invert()
+	if err == nil {
+		t.Fatalf("expected error inverting a fraction")
 	}
+}
+
+func TestKey(t *testing.T) {
 
+	e := New()
+	e.SetReader(strings.NewReader("aé"))
+
+	expected := []float64{1, 'a', 1, 'é', 0, -1}
+	for _, n := range expected {
+		var err error
+		if n == 0 || n == 1 {
+			err = e.keyp()
+		} else {
+			err = e.key()
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		out, _ := e.Stack.Pop()
+		if out != n {
+			t.Fatalf("expected %f, got %f", n, out)
+		}
+	}
 }
 
 func TestLt(t *testing.T) {
@@ -565,6 +840,38 @@ func TestMod(t *testing.T) {
 			t.Fatalf("wrong result %f %% 4.  Got %f, not %f", test.in, x, test.out)
 		}
 	}
+
+	// fractions are retained
+	e.Stack.Push(5.5)
+	e.Stack.Push(2)
+	err = e.mod()
+	if err != nil {
+		t.Fatalf("expected no error, but got one")
+	}
+	x, _ := e.Stack.Pop()
+	if x != 1.5 {
+		t.Fatalf("wrong result for 5.5 %% 2: %f", x)
+	}
+
+	// integers are exact
+	e.Stack.PushInt(-7)
+	e.Stack.PushInt(2)
+	err = e.mod()
+	if err != nil {
+		t.Fatalf("expected no error, but got one")
+	}
+	c, _ := e.Stack.PopCell()
+	if c != stack.IntCell(-1) {
+		t.Fatalf("wrong result for -7 %% 2: %v", c)
+	}
+
+	// division by zero
+	e.Stack.PushInt(7)
+	e.Stack.PushInt(0)
+	err = e.mod()
+	if err == nil {
+		t.Fatalf("expected error dividing by zero")
+	}
 }
 
 func TestMul(t *testing.T) {
@@ -606,6 +913,73 @@ func TestNop(t *testing.T) {
 	}
 }
 
+func TestNot(t *testing.T) {
+
+	e := New()
+
+	// empty stack
+	err := e.not()
+	if err == nil {
+		t.Fatalf("expected error with empty stack")
+	}
+
+	// 0 -> 1
+	e.Stack.Push(0)
+	e.not()
+	out, err2 := e.Stack.Pop()
+	if err2 != nil {
+		t.Errorf("unexpected error")
+	}
+	if out != 1 {
+		t.Errorf("unexpected result")
+	}
+
+	// 10 -> 0
+	e.Stack.Push(10)
+	e.not()
+	out, err2 = e.Stack.Pop()
+	if err2 != nil {
+		t.Errorf("unexpected error")
+	}
+	if out != 0 {
+		t.Errorf("unexpected result")
+	}
+
+}
+
+func TestNumberInput(t *testing.T) {
+
+	e := New()
+	e.SetReader(strings.NewReader(" 3.5 \nsteve\n"))
+
+	err := e.numberInput()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	out, _ := e.Stack.Pop()
+	if out != 3.5 {
+		t.Fatalf("expected 3.5, got %f", out)
+	}
+
+	// invalid number
+	err = e.numberInput()
+	if err == nil {
+		t.Fatalf("expected error, got none")
+	}
+	if !strings.Contains(err.Error(), "failed to convert") {
+		t.Fatalf("got an error, but the wrong one: %s", err.Error())
+	}
+
+	// end of input
+	err = e.numberInput()
+	if err == nil {
+		t.Fatalf("expected error, got none")
+	}
+	if !strings.Contains(err.Error(), "end of input") {
+		t.Fatalf("got an error, but the wrong one: %s", err.Error())
+	}
+}
+
 func TestOver(t *testing.T) {
 
 	e := New()
@@ -720,7 +1094,7 @@ func TestSetVar(t *testing.T) {
 
 	// Now set
 	e.Stack.Push(32.1)
-	e.Stack.Push(0)
+	e.Stack.PushInt(int64(e.vars[e.findVariable("name")].Addr))
 	err = e.setVar()
 	if err != nil {
 		t.Fatalf("unexpected error")
@@ -765,7 +1139,7 @@ func TestStrings(t *testing.T) {
 func TestStrlen(t *testing.T) {
 
 	e := New()
-	e.strings = append(e.strings, "Steve")
+	e.addString("Steve")
 
 	// call the function
 	err := e.strlen()
@@ -807,7 +1181,7 @@ func TestStrPrn(t *testing.T) {
 	e := New()
 
 	// We want to avoid spamming stdout, so our string to print is "empty"
-	e.strings = append(e.strings, "")
+	e.addString("")
 
 	// call the function
 	err := e.strprn()
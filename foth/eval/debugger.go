@@ -0,0 +1,202 @@
+// This file contains the support for debugging, which allows a host
+// application to pause execution when particular words are called, and
+// then single-step through them.
+//
+// The interpreter only decides when to pause, everything else is left to
+// the function registered via SetDebugger - which will typically prompt
+// the user for a command, as the REPL does.
+
+package eval
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Frame describes a word which is currently executing.
+type Frame struct {
+	// Word is the name of the word.
+	Word string
+
+	// Index is the position of the word in the dictionary.
+	Index int
+
+	// IP is the offset of the instruction which is about to be
+	// executed, within the word.
+	IP int
+
+	// File holds the name of the file in which the word was defined,
+	// if known.
+	File string
+
+	// Line holds the line-number from which the instruction at IP was
+	// compiled, or zero if unknown.
+	Line int
+}
+
+// String returns a description of the frame, which is suitable for
+// displaying in a backtrace.
+func (f Frame) String() string {
+	str := fmt.Sprintf("%s+%d", f.Word, f.IP)
+	if f.Line > 0 {
+		if f.File != "" {
+			str += fmt.Sprintf(" (%s:%d)", f.File, f.Line)
+		} else {
+			str += fmt.Sprintf(" (line %d)", f.Line)
+		}
+	}
+	return str
+}
+
+// DebugAction is returned by the debugger function, to tell the
+// interpreter how to continue.
+type DebugAction int
+
+const (
+	// DebugContinue runs until the next breakpoint is hit.
+	DebugContinue DebugAction = iota
+
+	// DebugStep pauses before the next instruction, stepping into
+	// any word which is called.
+	DebugStep
+
+	// DebugStepOver pauses before the next instruction of the current
+	// word, stepping over any word which is called.
+	DebugStepOver
+
+	// DebugAbort stops execution, and resets the interpreter.
+	DebugAbort
+)
+
+// SetDebugger registers the function which will be invoked when execution
+// pauses, at a breakpoint or when stepping.  Passing nil disables
+// debugging.
+//
+// The function can use Frames, Loops, Variables, and Decompile, to
+// inspect the state of the interpreter.
+func (e *Eval) SetDebugger(debugger func(*Eval) DebugAction) {
+	e.debugger = debugger
+}
+
+// SetBreakpoint arranges for execution to pause when the named word
+// is called.
+func (e *Eval) SetBreakpoint(name string) error {
+	idx := e.findWord(name)
+	if idx == -1 {
+		return fmt.Errorf("word '%s' not found", name)
+	}
+	if e.breakpoints == nil {
+		e.breakpoints = make(map[string]bool)
+	}
+	e.breakpoints[e.Dictionary[idx].Name] = true
+	return nil
+}
+
+// ClearBreakpoint removes the breakpoint from the named word.
+func (e *Eval) ClearBreakpoint(name string) {
+	idx := e.findWord(name)
+	if idx != -1 {
+		delete(e.breakpoints, e.Dictionary[idx].Name)
+	}
+}
+
+// Breakpoints returns the names of the words which have breakpoints.
+func (e *Eval) Breakpoints() []string {
+	res := []string{}
+	for name := range e.breakpoints {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Frames returns the words which are currently executing, outermost first.
+//
+// This is the closest thing we have to a return-stack.
+func (e *Eval) Frames() []Frame {
+	res := make([]Frame, len(e.frames))
+	for i, f := range e.frames {
+		res[i] = e.source(f)
+	}
+	return res
+}
+
+// backtrace returns the words which are currently executing, innermost
+// first.
+func (e *Eval) backtrace() []Frame {
+	res := make([]Frame, len(e.frames))
+	for i, f := range e.frames {
+		res[len(res)-1-i] = e.source(f)
+	}
+	return res
+}
+
+// source populates the file and line-number of the given frame.
+func (e *Eval) source(f Frame) Frame {
+	word := e.Dictionary[f.Index]
+	f.File = word.File
+	if f.IP >= 0 && f.IP < len(word.Lines) {
+		f.Line = word.Lines[f.IP]
+	}
+	return f
+}
+
+// Loops returns the loops which are currently executing, outermost first.
+func (e *Eval) Loops() []Loop {
+	res := make([]Loop, len(e.loops))
+	copy(res, e.loops)
+	return res
+}
+
+// Variables returns all the variables which have been defined, along
+// with their current values.
+func (e *Eval) Variables() []Variable {
+	res := make([]Variable, len(e.vars))
+	copy(res, e.vars)
+	for i := range res {
+		res[i].Value = e.memory[res[i].Addr]
+	}
+	return res
+}
+
+// debugPause is called before each instruction of a compiled word, and
+// before each word implemented in golang, to see if we should pause.
+//
+// Native words only pause when they have a breakpoint, rather than when
+// we're stepping.
+func (e *Eval) debugPause(native bool) error {
+
+	if e.debugger == nil {
+		return nil
+	}
+
+	depth := len(e.frames)
+
+	pause := e.breakHit
+	if !native {
+		switch e.stepMode {
+		case DebugStep:
+			pause = true
+		case DebugStepOver:
+			if depth <= e.stepDepth {
+				pause = true
+			}
+		}
+	}
+
+	if !pause {
+		return nil
+	}
+	e.breakHit = false
+
+	action := e.debugger(e)
+	if action == DebugAbort {
+		e.stepMode = DebugContinue
+		e.Reset()
+		return &AbortError{Message: "aborted by debugger"}
+	}
+
+	e.stepMode = action
+	e.stepDepth = depth
+	return nil
+}
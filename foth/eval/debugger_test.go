@@ -0,0 +1,220 @@
+package eval
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/skx/foth/foth/stack"
+)
+
+func TestBreakpoints(t *testing.T) {
+
+	e := New()
+
+	err := e.SetBreakpoint("missing")
+	if err == nil {
+		t.Fatalf("expected error setting breakpoint on a missing word")
+	}
+
+	err = e.Eval(": sq dup * ;")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	err = e.SetBreakpoint("SQ")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	err = e.SetBreakpoint("emit")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	bp := e.Breakpoints()
+	if len(bp) != 2 || bp[0] != "emit" || bp[1] != "sq" {
+		t.Fatalf("unexpected breakpoints: %v", bp)
+	}
+
+	e.ClearBreakpoint("emit")
+	e.ClearBreakpoint("missing")
+	bp = e.Breakpoints()
+	if len(bp) != 1 || bp[0] != "sq" {
+		t.Fatalf("unexpected breakpoints: %v", bp)
+	}
+}
+
+func TestDebugger(t *testing.T) {
+
+	var b bytes.Buffer
+
+	e := New()
+	e.SetWriter(bufio.NewWriter(&b))
+
+	err := e.Eval(": sq dup * ; : work 3 0 do i sq . loop ;")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	// Record where we paused, and respond with the given actions.
+	var seen []string
+	actions := []DebugAction{}
+	e.SetDebugger(func(ev *Eval) DebugAction {
+		frames := ev.Frames()
+		top := frames[len(frames)-1]
+		seen = append(seen, fmt.Sprintf("%s+%d", top.Word, top.IP))
+
+		if len(actions) == 0 {
+			return DebugContinue
+		}
+		a := actions[0]
+		actions = actions[1:]
+		return a
+	})
+
+	// Without breakpoints we never pause
+	err = e.Eval("work")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if len(seen) != 0 {
+		t.Fatalf("paused without a breakpoint: %v", seen)
+	}
+
+	// A breakpoint pauses each time the word is called
+	e.SetBreakpoint("sq")
+	err = e.Eval("work")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if fmt.Sprintf("%v", seen) != "[sq+0 sq+0 sq+0]" {
+		t.Fatalf("unexpected pauses: %v", seen)
+	}
+
+	// Stepping into, and then over.
+	seen = nil
+	actions = []DebugAction{DebugStep, DebugStep, DebugStepOver, DebugStepOver, DebugContinue}
+	err = e.Eval("work")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	expected := "[sq+0 sq+1 work+9 work+10 work+11 sq+0 sq+0]"
+	if fmt.Sprintf("%v", seen) != expected {
+		t.Fatalf("unexpected pauses: %v != %s", seen, expected)
+	}
+
+	// Stepping over a call doesn't stop inside it
+	e.ClearBreakpoint("sq")
+	e.SetBreakpoint("work")
+	seen = nil
+	actions = []DebugAction{DebugStepOver, DebugStepOver, DebugStepOver, DebugStepOver, DebugStepOver, DebugStepOver}
+	err = e.Eval("work")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	for _, s := range seen[:6] {
+		if s[:4] != "work" {
+			t.Fatalf("stepped into a word when stepping over: %v", seen)
+		}
+	}
+
+	// Aborting from the debugger
+	seen = nil
+	actions = []DebugAction{DebugAbort}
+	err = e.Eval("1 2 3 work")
+	var abort *AbortError
+	if !errors.As(err, &abort) {
+		t.Fatalf("expected an abort, got %v", err)
+	}
+	if !e.Stack.IsEmpty() || len(e.Loops()) != 0 {
+		t.Fatalf("state wasn't reset after aborting")
+	}
+	if len(e.Frames()) != 0 {
+		t.Fatalf("frames remain after aborting")
+	}
+
+	// Native words pause only on breakpoints
+	e.ClearBreakpoint("work")
+	e.SetBreakpoint("emit")
+	seen = nil
+	err = e.Eval("42 emit")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if fmt.Sprintf("%v", seen) != "[emit+0]" {
+		t.Fatalf("unexpected pauses: %v", seen)
+	}
+}
+
+func TestDebuggerState(t *testing.T) {
+
+	e := New()
+
+	err := e.Eval("variable x 3 x ! : inner ; : outer 5 0 do inner loop ;")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	var frames []Frame
+	var loops []Loop
+	var vars []Variable
+	e.SetBreakpoint("inner")
+	e.SetDebugger(func(ev *Eval) DebugAction {
+		frames = ev.Frames()
+		loops = ev.Loops()
+		vars = ev.Variables()
+		return DebugAbort
+	})
+
+	err = e.Eval("outer")
+	if err == nil {
+		t.Fatalf("expected an abort")
+	}
+
+	if len(frames) != 2 || frames[0].Word != "outer" || frames[1].Word != "inner" {
+		t.Fatalf("unexpected frames: %v", frames)
+	}
+	if len(loops) != 1 || loops[0].Max != 5 || loops[0].Current != 0 {
+		t.Fatalf("unexpected loops: %v", loops)
+	}
+	if len(vars) != 2 || vars[1].Name != "x" || vars[1].Value != stack.IntCell(3) {
+		t.Fatalf("unexpected variables: %v", vars)
+	}
+}
+
+func TestDecompile(t *testing.T) {
+
+	e := New()
+
+	_, err := e.Decompile(-1)
+	if err == nil {
+		t.Fatalf("expected an error for an invalid index")
+	}
+
+	err = e.Eval(": foo 3 0 do .\" x\" loop ;")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	codes, err := e.Decompile(e.findWord("foo"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if codes[0].Offset != 0 || codes[0].Text != "store 3" {
+		t.Fatalf("unexpected instruction: %v", codes[0])
+	}
+	if codes[1].Offset != 2 {
+		t.Fatalf("unexpected instruction: %v", codes[1])
+	}
+
+	// Native words have no instructions
+	codes, err = e.Decompile(e.findWord("emit"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if len(codes) != 0 {
+		t.Fatalf("native words should have no instructions")
+	}
+}
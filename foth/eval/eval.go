@@ -3,8 +3,12 @@ package eval
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"math/big"
 	"os"
 	"strconv"
 	"strings"
@@ -30,8 +34,15 @@ type Variable struct {
 	// Name is the name of the variable
 	Name string
 
+	// Addr is the address, within our memory, of the cell which
+	// holds the value of the variable.
+	Addr int
+
 	// Value is the value we store within it.
-	Value float64
+	//
+	// This is only present in the copies returned by Variables, as
+	// the value itself lives within our memory.
+	Value stack.Cell
 }
 
 // Word is the structure for a single word.
@@ -55,6 +66,10 @@ type Word struct {
 	// floats to the stack when compiling.
 	Words []float64
 
+	// Literals holds the integers used by this word, which can't
+	// always be stored exactly within Words.
+	Literals []stack.Cell
+
 	// Does this word switch us into immediate-mode?
 	StartImmediate bool
 
@@ -63,6 +78,50 @@ type Word struct {
 
 	// Does this word recurse?
 	Recursive bool
+
+	// Locals holds the names of the local variables used by this word,
+	// each invocation of which gets its own copy of them.
+	Locals []string
+
+	// File holds the name of the file this word was defined within,
+	// if known.
+	File string
+
+	// Lines holds the line-number from which each entry in Words was
+	// compiled, if known.
+	Lines []int
+}
+
+// Limits holds the resource-limits which are applied when evaluating
+// input, which is useful when running untrusted scripts.
+//
+// A zero value for any field means that there is no limit.
+type Limits struct {
+	// MaxInstructions is the maximum number of instructions which may
+	// be executed by a single call to `Eval`.
+	MaxInstructions int
+
+	// MaxStackDepth is the maximum number of entries the stack may hold.
+	MaxStackDepth int
+
+	// MaxCallDepth is the maximum depth of nested word-calls.
+	MaxCallDepth int
+
+	// MaxWords is the maximum number of words which may be defined,
+	// not counting the built-in words.
+	MaxWords int
+
+	// MaxStrings is the maximum number of entries the string-table
+	// may hold.
+	MaxStrings int
+
+	// MaxStringBytes is the maximum total length, in bytes, of the
+	// entries the string-table may hold.
+	MaxStringBytes int
+
+	// MaxMemory is the maximum number of cells our memory, arrays, and
+	// maps may hold - including those used by variables.
+	MaxMemory int
 }
 
 // Eval is our evaluation structure, which holds state of where
@@ -74,16 +133,25 @@ type Eval struct {
 	// Stack holds our operands.
 	Stack stack.Stack
 
+	// FStack holds the operands of our floating-point words.
+	FStack stack.Stack
+
 	// Dictionary entries
 	Dictionary []Word
 
-	// STDOUT is the writer used for `.`, `print`, and `emit` words
+	// STDOUT is the writer used for `.`, `print`, `emit`, and all
+	// other words which produce output.
 	STDOUT *bufio.Writer
 
+	// STDIN is the reader used for `key`, `accept`, and other words
+	// which read input.
+	STDIN *bufio.Reader
+
 	// Private details
 
-	// Literal strings.  As encountered in our program.
-	strings []string
+	// The strings we've created, both literal strings as encountered
+	// in our program, and those created at runtime.
+	strings stringHeap
 
 	// Have we already bumped our immediate-count?
 	//
@@ -104,6 +172,23 @@ type Eval struct {
 	// Temporary word we're compiling
 	tmp Word
 
+	// The number of built-in words, which don't count towards
+	// Limits.MaxWords.
+	builtins int
+
+	// The index of the dictionary entry which holds the temporary
+	// word we execute in immediate-mode, or -1 if there isn't one yet.
+	scratch int
+
+	// The locals declaration we're compiling, if any.
+	declaring *localsDecl
+
+	// Have we compiled `to`, and so expect the name of a local?
+	localTo bool
+
+	// The local variables of the words which are currently executing.
+	locals [][]stack.Cell
+
 	// We keep a stack of the last time we saw a `do` token,
 	// so we can pair it with the appropriate matching `loop`.
 	doOpen []int
@@ -125,8 +210,88 @@ type Eval struct {
 	// Variables
 	vars []Variable
 
-	// Are we currently defining a variable?
-	defining bool
+	// Our memory, which holds the values of our variables, as well as
+	// anything allocated via `allot`, `,`, and similar words.
+	memory []stack.Cell
+
+	// Arrays, and maps, which are referred to by their index.
+	arrays []array
+	maps   []table
+
+	// The index of the `base` variable, which holds the number-base
+	// used for parsing and printing numbers.
+	baseVar int
+
+	// Are we currently defining a variable, or similar?
+	//
+	// If so this is called with the name which follows.
+	defining func(name string) error
+
+	// Resource limits, if any.
+	limits Limits
+
+	// The number of instructions executed by the current call to Eval.
+	instructions int
+
+	// The words which are currently executing.
+	frames []Frame
+
+	// The context used by the current call to EvalContext, which
+	// allows execution to be cancelled.
+	ctx context.Context
+
+	// Are we profiling?
+	profiling bool
+
+	// The results of the current, or most recent, profiling run.
+	profiler *profiler
+
+	// The function to receive trace-events, if any.
+	tracer func(TraceEvent)
+
+	// The function to invoke when we pause execution, if any.
+	debugger func(*Eval) DebugAction
+
+	// The names of words which have breakpoints.
+	breakpoints map[string]bool
+
+	// Have we just entered a word with a breakpoint?
+	breakHit bool
+
+	// How should we continue after pausing, and at which depth
+	// of nested word-calls did we pause?
+	stepMode  DebugAction
+	stepDepth int
+
+	// The file, and starting line-number, of the input we're
+	// evaluating, as set by SetPosition.
+	sourceFile string
+	sourceLine int
+
+	// The line-number of the token we're currently processing.
+	line int
+
+	// The writer for diagnostic messages.
+	stderr io.Writer
+
+	// The writer for debug messages.
+	debugOut io.Writer
+
+	// Should `.` output a newline, rather than a space, after
+	// each number?
+	dotNewline bool
+
+	// The notation used to show floating-point numbers, and the
+	// number of digits shown.
+	floatFormat FloatFormat
+	precision   int
+
+	// Has the precision been chosen, via `set-precision`?
+	precisionSet bool
+
+	// The pictured numeric output we're building, if any.
+	pictured  []rune
+	picturing bool
 }
 
 var (
@@ -134,13 +299,79 @@ var (
 	//
 	// It should be expected as a normal, non-fatal, error from the Eval function.
 	ErrQuit = errors.New("RETURN")
+
+	// ErrInstructionLimit is returned when a call to Eval executes more
+	// instructions than permitted by Limits.MaxInstructions.
+	ErrInstructionLimit = errors.New("instruction limit exceeded")
+
+	// ErrStackLimit is returned when the stack grows beyond the size
+	// permitted by Limits.MaxStackDepth.
+	ErrStackLimit = errors.New("stack depth limit exceeded")
+
+	// ErrCallDepthLimit is returned when words are nested more deeply
+	// than permitted by Limits.MaxCallDepth.
+	ErrCallDepthLimit = errors.New("call depth limit exceeded")
+
+	// ErrDictionaryLimit is returned when defining a word would grow the
+	// dictionary beyond the size permitted by Limits.MaxWords.
+	ErrDictionaryLimit = errors.New("dictionary size limit exceeded")
+
+	// ErrStringLimit is returned when storing a string would grow the
+	// string-table beyond the size permitted by Limits.MaxStrings, or
+	// Limits.MaxStringBytes.
+	ErrStringLimit = errors.New("string table limit exceeded")
+
+	// ErrMemoryLimit is returned when allocating memory, or defining a
+	// variable, would grow our memory beyond the size permitted by
+	// Limits.MaxMemory.
+	ErrMemoryLimit = errors.New("memory limit exceeded")
 )
 
+// Error is returned when a runtime error occurs while executing a word,
+// and records where it happened.
+type Error struct {
+	// Err holds the underlying error.
+	Err error
+
+	// Backtrace holds the words which were executing when the error
+	// occurred, innermost first.
+	Backtrace []Frame
+}
+
+// Error returns the message of the underlying error.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// AbortError is the error returned when a script executes `abort`, or
+// `abort" ... "`.
+//
+// By the time this is returned the evaluator has already been reset, so
+// there is no need to call `Reset` to recover.
+type AbortError struct {
+	// Message holds the message given to `abort"`, which will be
+	// empty for a plain `abort`.
+	Message string
+}
+
+// Error returns the message associated with the abort.
+func (a *AbortError) Error() string {
+	if a.Message == "" {
+		return "aborted"
+	}
+	return a.Message
+}
+
 // New returns a simple evaluator, which will allow executing forth-like words.
 func New() *Eval {
 
 	// Empty structure
-	e := &Eval{}
+	e := &Eval{precision: defaultPrecision}
 
 	// Are we debugging?
 	if os.Getenv("DEBUG") != "" {
@@ -149,28 +380,83 @@ func New() *Eval {
 
 	// Populate our built-in functions.
 	e.Dictionary = []Word{
+		// bitwise
+		{Name: "2*", Function: e.twoMul},
+		{Name: "2/", Function: e.twoDiv},
+		{Name: "and", Function: e.bitAnd},
+		{Name: "arshift", Function: e.arshift},
+		{Name: "invert", Function: e.invert},
+		{Name: "lshift", Function: e.lshift},
+		{Name: "or", Function: e.bitOr},
+		{Name: "rshift", Function: e.rshift},
+		{Name: "xor", Function: e.bitXor},
+
 		// comparisons
+		{Name: "0=", Function: e.not},
 		{Name: "<", Function: e.lt},
 		{Name: "<=", Function: e.ltEq},
 		{Name: "=", Function: e.eq},
 		{Name: "==", Function: e.eq}, // synonym
 		{Name: ">", Function: e.gt},
 		{Name: ">=", Function: e.gtEq},
+		{Name: "not", Function: e.not},
 
 		// conditionals
 		{Name: "else", Function: e.nop},
 		{Name: "if", Function: e.nop, StartImmediate: true},
 		{Name: "then", Function: e.nop, EndImmediate: true},
 
+		// floating-point
+		{Name: ">f", Function: e.toFloat},
+		{Name: "f!", Function: e.fstore},
+		{Name: "f*", Function: e.fmul},
+		{Name: "f+", Function: e.fadd},
+		{Name: "f-", Function: e.fsub},
+		{Name: "f.", Function: e.fprint},
+		{Name: "f/", Function: e.fdiv},
+		{Name: "f0=", Function: e.fzeroEq},
+		{Name: "f<", Function: e.flt},
+		{Name: "f>", Function: e.fromFloat},
+		{Name: "f@", Function: e.ffetch},
+		{Name: "fconstant", Function: e.fconstant},
+		{Name: "fdrop", Function: e.fdrop},
+		{Name: "fdup", Function: e.fdup},
+		{Name: "fe.", Function: e.fprintEngineering},
+		{Name: "fover", Function: e.fover},
+		{Name: "fs.", Function: e.fprintScientific},
+		{Name: "fswap", Function: e.fswap},
+		{Name: "fvariable", Function: e.fvariable},
+		{Name: "precision", Function: e.getPrecision},
+		{Name: "set-precision", Function: e.setPrecision},
+
 		// debug-handling
 		{Name: "debug", Function: e.debugSet},
 		{Name: "debug?", Function: e.debugp},
 
 		// I/O
-		{Name: ".", Function: e.print},
+		{Name: ".", Function: e.dot},
 		{Name: ".\"", Function: e.nop},
+		{Name: ".r", Function: e.dotR},
+		{Name: "accept", Function: e.accept},
+		{Name: "bemit", Function: e.bemit},
+		{Name: "bkey", Function: e.bkey},
 		{Name: "emit", Function: e.emit},
+		{Name: "format", Function: e.format},
+		{Name: "key", Function: e.key},
+		{Name: "key?", Function: e.keyp},
+		{Name: "number-input", Function: e.numberInput},
 		{Name: "print", Function: e.print},
+		{Name: "printf", Function: e.printf},
+		{Name: "u.", Function: e.udot},
+		{Name: "u.r", Function: e.udotR},
+
+		// pictured numeric output
+		{Name: "#", Function: e.picturedDigit},
+		{Name: "#>", Function: e.picturedEnd},
+		{Name: "#s", Function: e.picturedDigits},
+		{Name: "<#", Function: e.picturedStart},
+		{Name: "hold", Function: e.hold},
+		{Name: "sign", Function: e.sign},
 
 		// loop-handling
 		{Name: "do", Function: e.nop, StartImmediate: true},
@@ -180,14 +466,52 @@ func New() *Eval {
 
 		// mathematical
 		{Name: "*", Function: e.mul},
+		{Name: "**", Function: e.pow},
 		{Name: "+", Function: e.add},
 		{Name: "-", Function: e.sub},
 		{Name: "/", Function: e.div},
+		{Name: ">big", Function: e.toBig},
+		{Name: ">rat", Function: e.toRat},
+		{Name: "abs", Function: e.abs},
+		{Name: "atan2", Function: e.atan2},
+		{Name: "ceil", Function: e.ceil},
+		{Name: "cos", Function: e.cos},
+		{Name: "e", Function: e.pushE},
+		{Name: "exp", Function: e.exp},
+		{Name: "f>s", Function: e.floatToInt},
+		{Name: "floor", Function: e.floor},
+		{Name: "fmod", Function: e.fmod},
+		{Name: "hypot", Function: e.hypot},
+		{Name: "inf?", Function: e.infp},
+		{Name: "ln", Function: e.ln},
+		{Name: "log10", Function: e.log10},
 		{Name: "max", Function: e.max},
 		{Name: "min", Function: e.min},
 		{Name: "mod", Function: e.mod},
+		{Name: "nan?", Function: e.nanp},
+		{Name: "pi", Function: e.pushPi},
+		{Name: "pow", Function: e.pow},
+		{Name: "round", Function: e.round},
+		{Name: "s>f", Function: e.intToFloat},
+		{Name: "sin", Function: e.sin},
+		{Name: "sqrt", Function: e.sqrt},
+		{Name: "tan", Function: e.tan},
+		{Name: "trunc", Function: e.trunc},
+
+		// profiling
+		{Name: ".profile", Function: e.profileReport},
+		{Name: "profile", Function: e.profileSet},
+		{Name: "profile?", Function: e.profilep},
+
+		// number-bases
+		{Name: "binary", Function: e.binary},
+		{Name: "decimal", Function: e.decimal},
+		{Name: "hex", Function: e.hex},
+		{Name: "octal", Function: e.octal},
 
 		// misc
+		{Name: "abort", Function: e.abort},
+		{Name: "abort\"", Function: e.nop},
 		{Name: "nop", Function: e.nop},
 
 		// stack-related
@@ -195,15 +519,44 @@ func New() *Eval {
 		{Name: "clearstack", Function: e.clearStack},
 		{Name: "drop", Function: e.drop},
 		{Name: "dup", Function: e.dup},
-		{Name: "invert", Function: e.invert},
 		{Name: "over", Function: e.over},
 		{Name: "swap", Function: e.swap},
 
+		// arrays
+		{Name: "a!", Function: e.arrayStore},
+		{Name: "a@", Function: e.arrayFetch},
+		{Name: "array", Function: e.defineArray},
+		{Name: "length", Function: e.length},
+		{Name: "resize", Function: e.resize},
+		{Name: "reverse", Function: e.reverse},
+		{Name: "sort", Function: e.sortArray},
+
+		// maps
+		{Name: "map", Function: e.defineMap},
+		{Name: "map-count", Function: e.mapCount},
+		{Name: "map-del", Function: e.mapDel},
+		{Name: "map-get", Function: e.mapGet},
+		{Name: "map-keys", Function: e.mapKeys},
+		{Name: "map-put", Function: e.mapPut},
+
 		// variable-handling
 		{Name: "!", Function: e.setVar},
 		{Name: "@", Function: e.getVar},
 		{Name: "variable", Function: e.variable},
 
+		// memory
+		{Name: "+!", Function: e.plusStore},
+		{Name: ",", Function: e.comma},
+		{Name: "allot", Function: e.allot},
+		{Name: "c!", Function: e.cStore},
+		{Name: "c,", Function: e.cComma},
+		{Name: "c@", Function: e.cFetch},
+		{Name: "cell+", Function: e.cellPlus},
+		{Name: "cells", Function: e.cells},
+		{Name: "fill", Function: e.fill},
+		{Name: "here", Function: e.here},
+		{Name: "move", Function: e.move},
+
 		// word-handling
 		{Name: "#words", Function: e.wordLen},
 		{Name: ":", Function: e.startDefinition},
@@ -212,11 +565,34 @@ func New() *Eval {
 		{Name: "words", Function: e.words},
 
 		// strings
+		{Name: ">number", Function: e.stringToNumber},
+		{Name: "f>string", Function: e.floatToString},
+		{Name: "lower", Function: e.lower},
+		{Name: "number>string", Function: e.numberToString},
+		{Name: "s+", Function: e.strcat},
+		{Name: "s>number?", Function: e.stringToNumberp},
+		{Name: "split", Function: e.split},
+		{Name: "strblen", Function: e.strblen},
+		{Name: "strcmp", Function: e.strcmp},
+		{Name: "strfind", Function: e.strfind},
 		{Name: "strings", Function: e.stringCount},
 		{Name: "strlen", Function: e.strlen},
 		{Name: "strprn", Function: e.strprn},
+		{Name: "strrev", Function: e.strrev},
+		{Name: "substr", Function: e.substr},
+		{Name: "trim", Function: e.trim},
+		{Name: "upper", Function: e.upper},
 	}
 
+	// The number-base is a real variable, so that it can be
+	// examined and changed via `base @` and `base !`.
+	e.baseVar = len(e.vars)
+	e.addVariable("base", stack.IntCell(10))
+
+	// Everything defined from here on counts towards our limits.
+	e.builtins = len(e.Dictionary)
+	e.scratch = -1
+
 	return e
 }
 
@@ -225,6 +601,31 @@ func New() *Eval {
 // This is the main public-facing the user of this library would be expected
 // to use.
 func (e *Eval) Eval(input string) error {
+	return e.EvalContext(context.Background(), input)
+}
+
+// EvalContext evaluates the given expression, stopping early if the
+// given context is cancelled or its deadline expires.
+//
+// Cancellation is checked before each instruction is executed, and results
+// in the context's error being returned, wrapped with the name of the word
+// which was running.  The contents of the stack are retained, but any loops
+// or definitions which were in progress are discarded, so the evaluator
+// may continue to be used afterwards.
+func (e *Eval) EvalContext(ctx context.Context, input string) error {
+
+	e.ctx = ctx
+	defer func() {
+		e.ctx = nil
+
+		// The position only applies to this input.
+		e.sourceFile = ""
+		e.sourceLine = 0
+	}()
+
+	// Any stepping from a previous call is over.
+	e.stepMode = DebugContinue
+	e.breakHit = false
 
 	// Lex our input string into a series of tokens.
 	//
@@ -244,6 +645,9 @@ func (e *Eval) Eval(input string) error {
 		return err
 	}
 
+	// Each call gets a fresh instruction-budget
+	e.instructions = 0
+
 	//
 	// For each token..
 	//
@@ -255,13 +659,22 @@ func (e *Eval) Eval(input string) error {
 		// in the case of string-literals
 		tok := token.Name
 
-		// Are we defining a variable?
-		if e.defining {
-			if e.debug {
-				fmt.Printf("defining variable %s\n", tok)
+		// Record where the token came from, in case we
+		// compile it.
+		e.line = token.Line
+		if e.sourceLine > 0 {
+			e.line += e.sourceLine - 1
+		}
+
+		// Are we defining a variable, or similar?
+		if e.defining != nil {
+			define := e.defining
+			e.defining = nil
+
+			err := define(tok)
+			if err != nil {
+				return err
 			}
-			e.vars = append(e.vars, Variable{Name: tok})
-			e.defining = false
 			continue
 		}
 
@@ -284,13 +697,22 @@ func (e *Eval) Eval(input string) error {
 			continue
 		}
 
+		// Is this a conditional abort?
+		if token.Type == lexer.ASTRING {
+			err := e.abortIf(token.Value)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
 		// Quit is also special-cased.
 		if tok == "quit" {
 			return ErrQuit
 		}
 
 		// Lookup this word from our dictionary
-		idx := e.findWord(tok)
+		idx := e.resolveWord(tok)
 		if idx != -1 {
 
 			// Are we starting immediate mode?
@@ -316,25 +738,36 @@ func (e *Eval) Eval(input string) error {
 			// Is this a variable?  If so push the variable offset
 			idx = e.findVariable(tok)
 			if idx >= 0 {
-				e.Stack.Push(float64(idx))
+				e.Stack.PushInt(int64(e.vars[idx].Addr))
 				continue
 			}
 
 			// String
 			if token.Type == lexer.STRING {
-				e.strings = append(e.strings, token.Value)
-				e.Stack.Push(float64(len(e.strings) - 1))
+				idx, err = e.addString(token.Value)
+				if err != nil {
+					return err
+				}
+				e.Stack.PushInt(int64(idx))
+				err = e.checkStack()
+				if err != nil {
+					return err
+				}
 				continue
 			}
 
 			// If we didn't handle this as a word, then
 			// assume it is a number.
-			i, err := strconv.ParseFloat(tok, 64)
+			i, err := e.parseNumber(tok)
 			if err != nil {
 				return fmt.Errorf("11 failed to convert %s to number %s", tok, err.Error())
 			}
 
-			e.Stack.Push(i)
+			e.Stack.PushCell(i)
+			err = e.checkStack()
+			if err != nil {
+				return err
+			}
 		}
 	}
 
@@ -349,7 +782,7 @@ func (e *Eval) GetVariable(name string) (float64, error) {
 
 	idx := e.findVariable(name)
 	if idx >= 0 {
-		return e.vars[idx].Value, nil
+		return e.memory[e.vars[idx].Addr].Float(), nil
 	}
 
 	return 0, fmt.Errorf("variable %s not found", name)
@@ -359,19 +792,30 @@ func (e *Eval) GetVariable(name string) (float64, error) {
 // thing to do if `Eval` returns an error
 func (e *Eval) Reset() {
 
-	// Clear the stack
+	// Clear the stacks
 	for !e.Stack.IsEmpty() {
 		e.Stack.Pop()
 	}
+	for !e.FStack.IsEmpty() {
+		e.FStack.Pop()
+	}
+
+	e.resetState()
+}
+
+// resetState resets everything other than the stack, leaving us ready
+// to interpret fresh input.
+func (e *Eval) resetState() {
 
 	// reset our state
-	e.defining = false
+	e.defining = nil
 	e.immediate = 0
 	e.compiling = false
 
 	// we're not defining anything
-	e.tmp.Name = ""
-	e.tmp.Words = []float64{}
+	e.tmp = Word{}
+	e.declaring = nil
+	e.localTo = false
 
 	// we're not in a do/loop
 	e.doOpen = []int{}
@@ -380,33 +824,107 @@ func (e *Eval) Reset() {
 	// we're not in a conditional
 	e.ifOffset1 = 0
 	e.ifOffset2 = 0
+
+	// we're not building any pictured numeric output
+	e.pictured = nil
+	e.picturing = false
+}
+
+// SetLimits configures the resource-limits which will be applied to
+// future calls to Eval.
+//
+// This is designed to be used by host-applications which embed this
+// library, and wish to run untrusted scripts.
+func (e *Eval) SetLimits(limits Limits) {
+	e.limits = limits
+}
+
+// SetPosition records the name of the file, and the line-number within
+// it, from which the next input passed to Eval was read.
+//
+// This allows runtime errors to report where the words involved were
+// defined, via the Backtrace of the returned Error.  Without this
+// line-numbers are relative to the input given to Eval.
+func (e *Eval) SetPosition(file string, line int) {
+	e.sourceFile = file
+	e.sourceLine = line
 }
 
 // SetVariable stores the specified value in the variable of the given
-// name.
+// name, defining it if necessary.
 //
 // This is designed to be used by host-applications which embed
-// this library.
+// this library, so Limits.MaxMemory doesn't apply.
 func (e *Eval) SetVariable(name string, value float64) {
 
 	idx := e.findVariable(name)
 	if idx >= 0 {
-		e.vars[idx].Value = value
+		e.memory[e.vars[idx].Addr] = stack.FloatCell(value)
 		return
 	}
 
-	e.vars = append(e.vars, Variable{Name: name, Value: value})
+	e.vars = append(e.vars, Variable{Name: name, Addr: len(e.memory)})
+	e.memory = append(e.memory, stack.FloatCell(value))
+}
+
+// SetDotNewline controls whether `.` outputs a newline after each number,
+// as it used to, rather than a space, as standard FORTH does.
+//
+// This is designed to be used by host-applications which embed this
+// library, and wish to retain compatibility with existing scripts.
+func (e *Eval) SetDotNewline(enabled bool) {
+	e.dotNewline = enabled
 }
 
 // SetWriter allows you to setup a special writer for all STDOUT
 // messages this application will produce.
 //
-// i.e. Writes from `.`, `emit`, `print`, and string-immediates will
-// go there.
+// i.e. Writes from `.`, `emit`, `print`, `words`, `dump`, and
+// string-immediates will go there.
 func (e *Eval) SetWriter(writer *bufio.Writer) {
 	e.STDOUT = writer
 }
 
+// SetOutput is a more general version of SetWriter, allowing any
+// io.Writer to receive our STDOUT messages.
+func (e *Eval) SetOutput(writer io.Writer) {
+	e.STDOUT = bufio.NewWriter(writer)
+}
+
+// SetReader allows you to setup a special reader, from which words such
+// as `key` and `accept` will read their input.  By default os.Stdin
+// is used.
+//
+// If the reader is already buffered it is used as-is, so that input
+// may be shared with the host application.
+func (e *Eval) SetReader(reader io.Reader) {
+	if buffered, ok := reader.(*bufio.Reader); ok {
+		e.STDIN = buffered
+		return
+	}
+	e.STDIN = bufio.NewReader(reader)
+}
+
+// SetErrorOutput sets the writer which receives diagnostic messages,
+// which defaults to os.Stderr.
+func (e *Eval) SetErrorOutput(writer io.Writer) {
+	e.stderr = writer
+}
+
+// SetDebugOutput sets the writer which receives the messages shown when
+// debugging is enabled, which defaults to os.Stdout.
+func (e *Eval) SetDebugOutput(writer io.Writer) {
+	e.debugOut = writer
+}
+
+// CaptureOutput redirects our STDOUT messages to a buffer, which is
+// returned.  This is primarily designed for testing.
+func (e *Eval) CaptureOutput() *bytes.Buffer {
+	var buf bytes.Buffer
+	e.SetOutput(&buf)
+	return &buf
+}
+
 // compileToken is called with a new token, when we're in compiling-mode.
 //
 // This is called in two ways:
@@ -450,22 +968,33 @@ func (e *Eval) compileToken(token lexer.Token) error {
 		return nil
 	}
 
+	// Are we declaring, or using, local variables?
+	handled, err := e.compileLocals(tok)
+	if err != nil {
+		return err
+	}
+	if handled {
+		return nil
+	}
+
 	// End of a definition?
 	if tok == ";" {
 
 		// Save the word to our dictionary
 		e.tmp.Name = strings.ToLower(e.tmp.Name)
-		e.Dictionary = append(e.Dictionary, e.tmp)
+		err := e.addWord(e.tmp)
+		if err != nil {
+			return err
+		}
 
 		// Show what we compiled each new definition
 		// to, when running in debug-mode
 		if e.debug {
-			e.dumpWord(len(e.Dictionary) - 1)
+			e.debugWord(len(e.Dictionary) - 1)
 		}
 
 		// reset for the next definition
-		e.tmp.Name = ""
-		e.tmp.Words = []float64{}
+		e.tmp = Word{}
 		e.compiling = false
 		return nil
 	}
@@ -476,7 +1005,7 @@ func (e *Eval) compileToken(token lexer.Token) error {
 	}
 
 	// Is the user adding an existing word to the definition?
-	idx := e.findWord(tok)
+	idx := e.resolveWord(tok)
 	if idx >= 0 {
 
 		//
@@ -500,7 +1029,7 @@ func (e *Eval) compileToken(token lexer.Token) error {
 		}
 
 		// Found the word, add to the end.
-		e.tmp.Words = append(e.tmp.Words, float64(idx))
+		e.compile(float64(idx))
 
 		//
 		// Now some special cases.
@@ -514,8 +1043,8 @@ func (e *Eval) compileToken(token lexer.Token) error {
 			e.doOpen = append(e.doOpen, len(e.tmp.Words)-1)
 
 			// we compile this into a "new-loop" instruction
-			e.tmp.Words = append(e.tmp.Words, -10)
-			e.tmp.Words = append(e.tmp.Words, 99) // dull
+			e.compile(-10)
+			e.compile(99) // dull
 		}
 
 		// if the word was a "LOOP"
@@ -527,15 +1056,15 @@ func (e *Eval) compileToken(token lexer.Token) error {
 			}
 
 			// We load the loop, increment, etc.
-			e.tmp.Words = append(e.tmp.Words, -11)
-			e.tmp.Words = append(e.tmp.Words, 99) // dull
+			e.compile(-11)
+			e.compile(99) // dull
 
 			// We've bumped the instance, and pushed
 			// a result onto the stack now.
 			//
 			// So we jump back to repeat if we must.
-			e.tmp.Words = append(e.tmp.Words, -3)
-			e.tmp.Words = append(e.tmp.Words, float64(e.doOpen[len(e.doOpen)-1]+3))
+			e.compile(-3)
+			e.compile(float64(e.doOpen[len(e.doOpen)-1] + 3))
 
 			// We've matched the do-loop pair - drop the
 			// open-reference
@@ -545,9 +1074,22 @@ func (e *Eval) compileToken(token lexer.Token) error {
 
 		// output a string-print operation, in compiled form
 		if token.Name == ".\"" {
-			e.strings = append(e.strings, token.Value)
-			e.tmp.Words = append(e.tmp.Words, -5)
-			e.tmp.Words = append(e.tmp.Words, float64(len(e.strings))-1)
+			str, err := e.addConstString(token.Value)
+			if err != nil {
+				return err
+			}
+			e.compile(-5)
+			e.compile(float64(str))
+		}
+
+		// output a conditional-abort, in compiled form
+		if token.Name == "abort\"" {
+			str, err := e.addConstString(token.Value)
+			if err != nil {
+				return err
+			}
+			e.compile(-6)
+			e.compile(float64(str))
 		}
 
 		//
@@ -590,9 +1132,9 @@ func (e *Eval) compileToken(token lexer.Token) error {
 			e.ifOffset2 = 0
 
 			// we add the conditional-jump opcode
-			e.tmp.Words = append(e.tmp.Words, -3)
+			e.compile(-3)
 			// placeholder jump-offset
-			e.tmp.Words = append(e.tmp.Words, 99)
+			e.compile(99)
 
 			// The offset of the last instruction is
 			// the 99-byte we just added as a placeholder
@@ -611,8 +1153,8 @@ func (e *Eval) compileToken(token lexer.Token) error {
 
 			// before we compile the end we have to
 			// add a jump to after the THEN
-			e.tmp.Words = append(e.tmp.Words, -4)
-			e.tmp.Words = append(e.tmp.Words, 999)
+			e.compile(-4)
+			e.compile(999)
 
 			e.ifOffset2 = len(e.tmp.Words)
 		}
@@ -645,20 +1187,24 @@ func (e *Eval) compileToken(token lexer.Token) error {
 
 			if e.immediate == 0 && imm {
 
-				// We've compiled the word.
-				e.Dictionary = append(e.Dictionary, e.tmp)
+				// We've compiled the word, so store it in the
+				// entry we reuse for each temporary word.
+				if e.scratch < 0 {
+					e.Dictionary = append(e.Dictionary, e.tmp)
+					e.scratch = len(e.Dictionary) - 1
+				} else {
+					e.Dictionary[e.scratch] = e.tmp
+				}
 
 				if e.debug {
-					fmt.Printf("Completed the temporary word - '$ $'\n")
-					e.dumpWord(len(e.Dictionary) - 1)
+					e.debugf("Completed the temporary word - '$ $'\n")
+					e.debugWord(e.scratch)
 				}
 
 				// reset for the next definition
-				e.tmp.Name = ""
-				e.tmp.Words = []float64{}
+				e.tmp = Word{}
 				// Run it.
-				e.evalWord(len(e.Dictionary) - 1)
-				return nil
+				return e.evalWord(e.scratch)
 			}
 		}
 
@@ -670,54 +1216,132 @@ func (e *Eval) compileToken(token lexer.Token) error {
 	idx = e.findVariable(tok)
 	if idx >= 0 {
 		// compile this into something that will push
-		// the offset of the variable onto the stack
-		e.tmp.Words = append(e.tmp.Words, -1)
-		e.tmp.Words = append(e.tmp.Words, float64(idx))
+		// the address of the variable onto the stack
+		e.compileLiteral(stack.IntCell(int64(e.vars[idx].Addr)))
 		return nil
 	}
 
 	// save a string, in compiled form
 	if token.Name == "\"" {
-		e.strings = append(e.strings, token.Value)
-		e.tmp.Words = append(e.tmp.Words, -1)
-		e.tmp.Words = append(e.tmp.Words, float64(len(e.strings))-1)
+		str, err := e.addConstString(token.Value)
+		if err != nil {
+			return err
+		}
+		e.compileLiteral(stack.IntCell(int64(str)))
 		return nil
 	}
 
-	// Convert to float
-	val, err := strconv.ParseFloat(tok, 64)
+	// Convert to a number
+	val, err := e.parseNumber(tok)
 	if err != nil {
 
 		if e.tmp.Recursive {
-			e.tmp.Words = append(e.tmp.Words, float64(len(e.Dictionary)))
+			e.compile(float64(len(e.Dictionary)))
 			return nil
 		}
 		return fmt.Errorf("22 failed to convert %s to number %s", tok, err.Error())
 	}
 
-	// At this point we assume the user entered a number
+	// Integers, of all sizes, and rationals are stored in our
+	// literal-area.
+	if val.Kind != stack.Float {
+		e.compileLiteral(val)
+		return nil
+	}
+
+	// At this point we assume the user entered a float
 	// so we save a magic "-1" flag in our
 	// definition, and then the number itself
-	e.tmp.Words = append(e.tmp.Words, -1)
-	e.tmp.Words = append(e.tmp.Words, val)
+	e.compile(-1)
+	e.compile(val.F)
 
 	return nil
 }
 
-// dumpWord dumps the definition of the given word.
-func (e *Eval) dumpWord(idx int) {
+// parseNumber converts the given token to a number.
+//
+// Tokens which are valid integers become integer cells, anything
+// else (e.g. "1.5", "1e3", or "3.0") becomes a floating-point cell.
+//
+// Arbitrary-precision integers have an "n" suffix (e.g. "123n"), and
+// rationals an "r" suffix (e.g. "1/3r" or "0.25r").
+//
+// Integers are parsed in the current number-base, unless they have
+// a prefix of "$" (hexadecimal), "#" (decimal), or "%" (binary), while
+// floating-point and rational numbers are only recognized in decimal.
+func (e *Eval) parseNumber(tok string) (stack.Cell, error) {
+	base := e.numberBase()
+	if len(tok) > 1 {
+		switch tok[0] {
+		case '$':
+			base = 16
+			tok = tok[1:]
+		case '#':
+			base = 10
+			tok = tok[1:]
+		case '%':
+			base = 2
+			tok = tok[1:]
+		}
+	}
+
+	if len(tok) > 1 && strings.HasSuffix(tok, "n") {
+		b, ok := new(big.Int).SetString(tok[:len(tok)-1], base)
+		if !ok {
+			return stack.Cell{}, fmt.Errorf("invalid integer")
+		}
+		return stack.BigIntCell(b), nil
+	}
+
+	i, err := strconv.ParseInt(tok, base, 64)
+	if err == nil {
+		return stack.IntCell(i), nil
+	}
+	if base != 10 {
+		return stack.Cell{}, err
+	}
+
+	if len(tok) > 1 && strings.HasSuffix(tok, "r") {
+		r, ok := new(big.Rat).SetString(tok[:len(tok)-1])
+		if !ok {
+			return stack.Cell{}, fmt.Errorf("invalid rational")
+		}
+		return stack.BigRatCell(r), nil
+	}
+
+	f, err := strconv.ParseFloat(tok, 64)
+	if err != nil {
+		return stack.Cell{}, err
+	}
+	return stack.FloatCell(f), nil
+}
+
+// Instruction is a single decompiled instruction, from the definition
+// of a word.
+type Instruction struct {
+	// Offset is the position of the instruction within the word.
+	Offset int
+
+	// Text is the human-readable form of the instruction.
+	Text string
+}
+
+// Decompile returns the compiled form of the word with the given index,
+// in a human-readable form.
+//
+// Words implemented in golang have no instructions to return.
+func (e *Eval) Decompile(idx int) ([]Instruction, error) {
 
 	// Ensure we have a valid index
 	if idx >= len(e.Dictionary) || idx < 0 {
-		fmt.Printf("Invalid index\n")
-		return
+		return nil, fmt.Errorf("invalid index")
 	}
 
 	// Lookup the word
 	word := e.Dictionary[idx]
 
 	// Store temporary data here
-	codes := []string{}
+	codes := []Instruction{}
 
 	// Walk over the opcodes in the word-definition
 	off := 0
@@ -730,40 +1354,87 @@ func (e *Eval) dumpWord(idx int) {
 		// Values <0 are "magic", and were created via
 		// the "compilation" process.
 		v := word.Words[int(off)]
+		txt := ""
+		start := off
 
 		if v == -1 {
-			codes = append(codes, fmt.Sprintf("%d: store %f", off, word.Words[off+1]))
+			txt = fmt.Sprintf("store %f", word.Words[off+1])
+			off++
+		} else if v == -2 {
+			txt = fmt.Sprintf("store %s", word.Literals[int(word.Words[off+1])])
 			off++
 		} else if v == -3 {
-			codes = append(codes, fmt.Sprintf("%d: [cond-jmp %f]", off, word.Words[off+1]))
+			txt = fmt.Sprintf("[cond-jmp %f]", word.Words[off+1])
 			off++
 		} else if v == -4 {
-			codes = append(codes, fmt.Sprintf("%d: [jmp %f]", off, word.Words[off+1]))
+			txt = fmt.Sprintf("[jmp %f]", word.Words[off+1])
 			off++
 		} else if v == -5 {
-			codes = append(codes, fmt.Sprintf("%d: [print-string %f (\"%s\")]", off, word.Words[off+1], e.strings[int(word.Words[off+1])]))
+			txt = fmt.Sprintf("[print-string %f (\"%s\")]", word.Words[off+1], e.strings.values[int(word.Words[off+1])])
+			off++
+		} else if v == -6 {
+			txt = fmt.Sprintf("[abort-string %f (\"%s\")]", word.Words[off+1], e.strings.values[int(word.Words[off+1])])
+			off++
+		} else if v == -12 {
+			txt = fmt.Sprintf("[local-fetch %s]", word.Locals[int(word.Words[off+1])])
+			off++
+		} else if v == -13 {
+			txt = fmt.Sprintf("[local-store %s]", word.Locals[int(word.Words[off+1])])
 			off++
 		} else if v == -10 {
-			codes = append(codes, fmt.Sprintf("%d: [new-loop]", off))
+			txt = "[new-loop]"
 			off++
 		} else if v == -11 {
-			codes = append(codes, fmt.Sprintf("%d: [loop-test]", off))
+			txt = "[loop-test]"
 			off++
 		} else {
-			codes = append(codes, fmt.Sprintf("%d: %s", off, e.Dictionary[int(v)].Name))
+			txt = e.Dictionary[int(v)].Name
 		}
+		codes = append(codes, Instruction{Offset: start, Text: txt})
 
 		// keep going for further words
 		off++
 	}
 
+	return codes, nil
+}
+
+// compile appends the given opcode to the word we're compiling, along
+// with the position it came from.
+func (e *Eval) compile(opcode float64) {
+	e.tmp.Words = append(e.tmp.Words, opcode)
+	e.tmp.Lines = append(e.tmp.Lines, e.line)
+	e.tmp.File = e.sourceFile
+}
+
+// compileLiteral appends an instruction to push the given integer to
+// the word we're compiling, storing it in the literal-area.
+func (e *Eval) compileLiteral(val stack.Cell) {
+	e.compile(-2)
+	e.compile(float64(len(e.tmp.Literals)))
+	e.tmp.Literals = append(e.tmp.Literals, val)
+}
+
+// dumpWord returns the definition of the given word, in a human-readable
+// form.
+func (e *Eval) dumpWord(idx int) (string, error) {
+
+	codes, err := e.Decompile(idx)
+	if err != nil {
+		return "", err
+	}
+
 	// Didn't decompile?  Then it was a native-word
 	if len(codes) == 0 {
-		fmt.Printf("Word '%s' - [Native]\n", word.Name)
-	} else {
-		// Otherwise show the bytecode.
-		fmt.Printf("Word '%s'\n %s\n", word.Name, strings.Join(codes, "\n "))
+		return fmt.Sprintf("Word '%s' - [Native]\n", e.Dictionary[idx].Name), nil
 	}
+
+	// Otherwise show the bytecode.
+	lines := []string{}
+	for _, code := range codes {
+		lines = append(lines, fmt.Sprintf("%d: %s", code.Offset, code.Text))
+	}
+	return fmt.Sprintf("Word '%s'\n %s\n", e.Dictionary[idx].Name, strings.Join(lines, "\n ")), nil
 }
 
 // evalWord evaluates a word, by index from the dictionary
@@ -780,6 +1451,9 @@ func (e *Eval) dumpWord(idx int) {
 //
 //	    "-1" means the next value is a number
 //
+//	    "-2" means the next value is the offset of an integer, stored
+//	    in the literal-area of the word.
+//
 //	    "-3" is a conditional-jump, which will change our IP if
 //	    the topmost item on the stack is "0".
 //
@@ -788,29 +1462,94 @@ func (e *Eval) dumpWord(idx int) {
 //	    "-5" prints a string, stored in our literal-area.
 //	    Dynamic strings are not supported.
 //
+//	    "-6" aborts, with a message stored in our literal-area, if
+//	    the topmost item on the stack is non-zero.
+//
 //	    "-10" creates a new Loop structure.
 //	    (i.e. `do`).
 //
 //	    "-11" handles the test/termination of a loop condition.
 //	    (i.e. `loop`).
-func (e *Eval) evalWord(index int) error {
+//
+//	    "-12" pushes the value of the local variable whose index follows.
+//
+//	    "-13" pops a value into the local variable whose index follows.
+func (e *Eval) evalWord(index int) (err error) {
+
+	// Have we nested too deeply?
+	if e.limits.MaxCallDepth > 0 && len(e.frames) >= e.limits.MaxCallDepth {
+		return ErrCallDepthLimit
+	}
 
 	// Lookup the word in our dictionary.
 	word := e.Dictionary[index]
 
+	// Record that we're running this word.
+	frame := len(e.frames)
+	e.frames = append(e.frames, Frame{Word: word.Name, Index: index})
+	defer func() { e.frames = e.frames[:frame] }()
+
+	// If we're the first to see an error then record
+	// the words which were executing.
+	defer func() {
+		if err == nil {
+			return
+		}
+		var bt *Error
+		if !errors.As(err, &bt) {
+			err = &Error{Err: err, Backtrace: e.backtrace()}
+		}
+	}()
+
+	// Does this word have a breakpoint?
+	if e.debugger != nil && e.breakpoints[word.Name] {
+		e.breakHit = true
+	}
+
+	// Record the call if we're profiling.
+	//
+	// We keep hold of the profiler, as the word we're running
+	// might turn profiling on, or off.
+	if e.profiling {
+		p := e.profiler
+		p.enter(index, word.Name)
+		defer p.exit()
+	}
+
+	// Let any tracer know we've started, and finished.
+	if e.tracer != nil {
+		e.trace(TraceEvent{Kind: TraceWordEnter, Word: word.Name})
+		defer func() {
+			e.trace(TraceEvent{Kind: TraceWordExit, Word: word.Name, Err: err})
+		}()
+	}
+
 	// Is this implemented in golang?  If so just invoke the function
 	// and we're done.
 	if word.Function != nil {
 
+		err := e.step(word.Name)
+		if err != nil {
+			return err
+		}
+
+		err = e.debugPause(true)
+		if err != nil {
+			return err
+		}
+
 		if e.debug {
-			fmt.Printf(" calling built-in word %s\n", word.Name)
+			e.debugf(" calling built-in word %s\n", word.Name)
 		}
-		err := word.Function()
-		return err
+		err = word.Function()
+		if err != nil {
+			return err
+		}
+		return e.checkStack()
 	}
 
 	if e.debug {
-		fmt.Printf(" calling dynamic stuff\n")
+		e.debugf(" calling dynamic stuff\n")
 	}
 
 	//
@@ -830,27 +1569,86 @@ func (e *Eval) evalWord(index int) error {
 
 	state := "default"
 
+	// An empty definition has no instructions to pause before,
+	// so we treat it like a native word.
+	if len(word.Words) == 0 {
+		err = e.debugPause(true)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Each invocation gets its own local variables.
+	var locals []stack.Cell
+	if len(word.Locals) > 0 {
+		locals = zeros(int64(len(word.Locals)))
+		depth := len(e.locals)
+		e.locals = append(e.locals, locals)
+		defer func() { e.locals = e.locals[:depth] }()
+	}
+
 	// We need to allow control-jumps now, so we
 	// have to store our index manually.
 	ip := 0
 	for ip < len(word.Words) {
 
+		// Are we permitted to execute another instruction?
+		err := e.step(word.Name)
+		if err != nil {
+			return err
+		}
+
 		// the current opcode
 		opcode := word.Words[ip]
 
 		// adding a number?
 		if state == "add-number" {
 			if e.debug {
-				fmt.Printf(" storing %f on stack\n", opcode)
+				e.debugf(" storing %f on stack\n", opcode)
 			}
 
 			// add to stack
 			e.Stack.Push(opcode)
 
+			state = "default"
+		} else if state == "add-literal" {
+			val := word.Literals[int(opcode)]
+			if e.debug {
+				e.debugf(" storing %s on stack\n", val)
+			}
+
+			// add to stack
+			e.Stack.PushCell(val)
+
+			state = "default"
+		} else if state == "fetch-local" {
+			val := locals[int(opcode)]
+			if e.debug {
+				e.debugf(" storing local %s (%s) on stack\n", word.Locals[int(opcode)], val)
+			}
+			e.Stack.PushCell(val)
+			state = "default"
+		} else if state == "store-local" {
+			val, err := e.Stack.PopCell()
+			if err != nil {
+				return err
+			}
+			if e.debug {
+				e.debugf(" storing %s in local %s\n", val, word.Locals[int(opcode)])
+			}
+			locals[int(opcode)] = val
 			state = "default"
 		} else if state == "string-print" {
 			// print a string
-			e.printString(e.strings[int(opcode)])
+			e.printString(e.strings.values[int(opcode)])
+			state = "default"
+
+		} else if state == "abort-string" {
+			// abort, if the flag is set
+			err := e.abortIf(e.strings.values[int(opcode)])
+			if err != nil {
+				return err
+			}
 			state = "default"
 
 		} else if state == "cond-jump" {
@@ -865,7 +1663,7 @@ func (e *Eval) evalWord(index int) error {
 			if val == 0 {
 				if e.debug {
 
-					fmt.Printf(" popped %f from stack - jumping to %f\n", val, opcode)
+					e.debugf(" popped %f from stack - jumping to %f\n", val, opcode)
 				}
 				// change opcode
 				ip = int(opcode)
@@ -874,7 +1672,7 @@ func (e *Eval) evalWord(index int) error {
 				ip--
 			} else {
 				if e.debug {
-					fmt.Printf(" popped %f from stack - not making conditional jump\n", val)
+					e.debugf(" popped %f from stack - not making conditional jump\n", val)
 				}
 			}
 			state = "default"
@@ -913,12 +1711,12 @@ func (e *Eval) evalWord(index int) error {
 
 			// test to see if the loop is over
 			if e.loops[l].Current >= e.loops[l].Max {
-				e.Stack.Push(1)
+				e.Stack.PushInt(1)
 
 				// loop is over now
 				e.loops = e.loops[:len(e.loops)-1]
 			} else {
-				e.Stack.Push(0)
+				e.Stack.PushInt(0)
 			}
 
 			state = "default"
@@ -932,19 +1730,39 @@ func (e *Eval) evalWord(index int) error {
 			state = "default"
 		} else if state == "default" {
 
+			// Keep track of where we are, and see if we
+			// should pause before continuing.
+			e.frames[frame].IP = ip
+			err = e.debugPause(false)
+			if err != nil {
+				return err
+			}
+
+			if e.tracer != nil {
+				e.trace(TraceEvent{Kind: TraceOpcode, Word: word.Name, IP: ip, Opcode: opcode})
+			}
+
 			switch opcode {
 			case -1:
 				state = "add-number"
+			case -2:
+				state = "add-literal"
 			case -3:
 				state = "cond-jump"
 			case -4:
 				state = "jump"
 			case -5:
 				state = "string-print"
+			case -6:
+				state = "abort-string"
 			case -10:
 				state = "new-loop"
 			case -11:
 				state = "loop-test"
+			case -12:
+				state = "fetch-local"
+			case -13:
+				state = "store-local"
 			default:
 				err := e.evalWord(int(opcode))
 				if err != nil {
@@ -962,6 +1780,52 @@ func (e *Eval) evalWord(index int) error {
 	return nil
 }
 
+// step is called before every instruction is executed, within the named
+// word, to enforce our resource-limits and allow cancellation.
+func (e *Eval) step(name string) error {
+	e.instructions++
+	if e.limits.MaxInstructions > 0 && e.instructions > e.limits.MaxInstructions {
+		return ErrInstructionLimit
+	}
+
+	if e.ctx != nil {
+		select {
+		case <-e.ctx.Done():
+			e.resetState()
+			return fmt.Errorf("interrupted while running '%s': %w", name, e.ctx.Err())
+		default:
+		}
+	}
+
+	return e.checkStack()
+}
+
+// checkStack ensures the stacks haven't grown beyond our limit.
+func (e *Eval) checkStack() error {
+	if e.limits.MaxStackDepth > 0 {
+		if e.Stack.Len() > e.limits.MaxStackDepth || e.FStack.Len() > e.limits.MaxStackDepth {
+			return ErrStackLimit
+		}
+	}
+	return nil
+}
+
+// addWord appends the given word to our dictionary.
+//
+// Only the words defined after New count towards Limits.MaxWords, and
+// the temporary word used in immediate-mode is never counted.
+func (e *Eval) addWord(word Word) error {
+	defined := len(e.Dictionary) - e.builtins
+	if e.scratch >= 0 {
+		defined--
+	}
+	if e.limits.MaxWords > 0 && defined >= e.limits.MaxWords {
+		return ErrDictionaryLimit
+	}
+	e.Dictionary = append(e.Dictionary, word)
+	return nil
+}
+
 // findVariable returns the index of the specified variable in our list
 // of variables.
 //
@@ -993,29 +1857,108 @@ func (e *Eval) findWord(name string) int {
 	return -1
 }
 
-// printNumber - outputs a floating-point number.  However if the
-// value is actually an integer then that is displayed instead.
-func (e *Eval) printNumber(n float64) {
+// resolveWord returns the index of the word to run for the given token,
+// or -1 if there is no such word.
+//
+// This is the same as findWord, except the built-in constants are hidden
+// by a variable with exactly the same name.
+func (e *Eval) resolveWord(tok string) int {
+	idx := e.findWord(tok)
+	if idx != -1 && constants[e.Dictionary[idx].Name] && e.findVariable(tok) >= 0 {
+		return -1
+	}
+	return idx
+}
 
-	// If the value on the top of the stack is an integer
-	// then show it as one - i.e. without any ".00000".
-	if float64(int(n)) == n {
-		e.printString(fmt.Sprintf("%d", int(n)))
-		return
+// numberBase returns the current number-base, as held in the `base`
+// variable.  Invalid values are treated as decimal.
+func (e *Eval) numberBase() int {
+	base := e.memory[e.vars[e.baseVar].Addr].Int()
+	if base < 2 || base > 36 {
+		return 10
 	}
+	return int(base)
+}
 
-	// OK we have a floating-point result.  Show it, but
-	// remove any trailing "0".
-	//
-	// This means we get 1.25 instead of 1.2500000 shown
-	// when the user runs `5 4 / .`.
-	//
-	output := fmt.Sprintf("%f", n)
+// printNumber - outputs a number.  Integers are shown exactly, as are
+// floating-point numbers which happen to hold an integer value.
+//
+// Rational numbers are shown as a fraction, e.g. "1/3".
+//
+// Integers, and rationals, are shown in the current number-base, but
+// floating-point numbers are always shown in decimal.
+func (e *Eval) printNumber(c stack.Cell) {
+	e.printString(e.formatNumber(c))
+}
+
+// formatNumber returns the string printNumber would output for the
+// given number.
+func (e *Eval) formatNumber(c stack.Cell) string {
+
+	base := e.numberBase()
+
+	switch c.Kind {
+	case stack.Int:
+		return strings.ToUpper(strconv.FormatInt(c.I, base))
+	case stack.BigInt:
+		return strings.ToUpper(c.B.Text(base))
+	case stack.Array, stack.Map:
+		return c.String()
+	case stack.BigRat:
+		str := c.R.Num().Text(base)
+		if !c.R.IsInt() {
+			str += "/" + c.R.Denom().Text(base)
+		}
+		return strings.ToUpper(str)
+	}
+	return e.formatFloat(c.F, e.floatFormat)
+}
+
+// debugf outputs a message to our debug-writer.
+func (e *Eval) debugf(format string, args ...interface{}) {
+	if e.debugOut == nil {
+		e.debugOut = os.Stdout
+	}
+	fmt.Fprintf(e.debugOut, format, args...)
+}
+
+// debugWord outputs the definition of the given word to our debug-writer.
+func (e *Eval) debugWord(idx int) {
+	str, err := e.dumpWord(idx)
+	if err == nil {
+		e.debugf("%s", str)
+	}
+}
 
-	for strings.HasSuffix(output, "0") {
-		output = strings.TrimSuffix(output, "0")
+// errorf outputs a diagnostic message to our error-writer.
+func (e *Eval) errorf(format string, args ...interface{}) {
+	if e.stderr == nil {
+		e.stderr = os.Stderr
 	}
-	e.printString(output)
+	fmt.Fprintf(e.stderr, format, args...)
+}
+
+// input returns the reader we use for input, taking into account that
+// STDIN might have been replaced via `SetReader`.
+func (e *Eval) input() *bufio.Reader {
+	if e.STDIN == nil {
+		e.STDIN = bufio.NewReader(os.Stdin)
+	}
+	return e.STDIN
+}
+
+// readLine reads a line of input, without the trailing newline.
+//
+// At the end of our input we return io.EOF, but only if nothing
+// at all could be read.
+func (e *Eval) readLine() (string, error) {
+	line, err := e.input().ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return line, nil
 }
 
 // printString outputs a string, taking into account that
@@ -1028,4 +1971,8 @@ func (e *Eval) printString(str string) {
 
 	e.STDOUT.WriteString(str)
 	e.STDOUT.Flush()
+
+	if e.tracer != nil {
+		e.trace(TraceEvent{Kind: TracePrint, Text: str})
+	}
 }
@@ -3,9 +3,14 @@ package eval
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"os"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/skx/foth/foth/stack"
 )
 
 func TestBasic(t *testing.T) {
@@ -196,8 +201,8 @@ func TestIfThenElse(t *testing.T) {
 		{input: ": f 3 3 = if 1 then ; f", result: 1},
 		{input: ": f 3 3 = if .\" ok \" 1 then ; f", result: 1},
 
-		{input: "3 3 = invert if 1 else 2 then", result: 2},
-		{input: ": f 3 3 = invert if 1 else 2 then ; f", result: 2},
+		{input: "3 3 = not if 1 else 2 then", result: 2},
+		{input: ": f 3 3 = not if 1 else 2 then ; f", result: 2},
 
 		{input: "3 31 = if 0 else 3 then", result: 3},
 		{input: ": f 3 31 = if 0 else 3 then ; f ", result: 3},
@@ -205,8 +210,8 @@ func TestIfThenElse(t *testing.T) {
 		{input: "3 31 = if 1 else 12 then", result: 12},
 		{input: ": f 3 31 = if 1 else 12 then ; f", result: 12},
 
-		{input: "3 21 = invert if 221 else 112 then", result: 221},
-		{input: ": ff 3 21 = invert if 221 else 112 then ; ff ", result: 221},
+		{input: "3 21 = not if 221 else 112 then", result: 221},
+		{input: ": ff 3 21 = not if 221 else 112 then ; ff ", result: 221},
 	}
 
 	for _, test := range tests {
@@ -239,6 +244,117 @@ func TestIfThenElse(t *testing.T) {
 	}
 }
 
+func TestIntegers(t *testing.T) {
+
+	type TestCase struct {
+		input  string
+		result stack.Cell
+	}
+
+	tests := []TestCase{
+		{"3", stack.IntCell(3)},
+		{"3.0", stack.FloatCell(3)},
+		{"1e3", stack.FloatCell(1000)},
+		{"-12", stack.IntCell(-12)},
+		{"9007199254740993 1 +", stack.IntCell(9007199254740994)},
+		{"2 3.5 *", stack.FloatCell(7)},
+		{"10 4 /", stack.FloatCell(2.5)},
+		{"10 5 /", stack.IntCell(2)},
+		{"3 s>f f>", stack.FloatCell(3)},
+		{"3.9 f>s", stack.IntCell(3)},
+		{"9007199254740993 9007199254740992 >", stack.IntCell(1)},
+		{": big 9007199254740993 ; big", stack.IntCell(9007199254740993)},
+		{": loopy 0 3 0 do i + loop ; loopy", stack.IntCell(3)},
+	}
+
+	for _, test := range tests {
+
+		e := New()
+		err := e.Eval(test.input)
+		if err != nil {
+			t.Fatalf("unexpected error evaluating '%s': %s", test.input, err.Error())
+		}
+
+		out, err := e.Stack.PopCell()
+		if err != nil {
+			t.Fatalf("failed to get stack value for '%s'", test.input)
+		}
+		if out != test.result {
+			t.Fatalf("'%s' gave %v (kind %d), not %v", test.input, out, out.Kind, test.result)
+		}
+	}
+
+	// Big integers are printed exactly
+	e := New()
+	out := e.CaptureOutput()
+	err := e.Eval("9007199254740993 . 2.5 .")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if out.String() != "9007199254740993 2.5 " {
+		t.Fatalf("unexpected output: %s", out.String())
+	}
+}
+
+func TestNumberBases(t *testing.T) {
+
+	type TestCase struct {
+		input  string
+		output string
+	}
+
+	tests := []TestCase{
+		{"base @ .", "10 "},
+		{"hex base @ decimal .", "16 "},
+		{"255 hex .", "FF "},
+		{"hex ff decimal .", "255 "},
+		{"hex -1A decimal .", "-26 "},
+		{"binary 1010 decimal .", "10 "},
+		{"octal 17 decimal .", "15 "},
+		{"10 binary .", "1010 "},
+		{"8 octal .", "10 "},
+		{"35 36 base ! . decimal", "Z "},
+		{"36 base ! z decimal .", "35 "},
+		{"$FF .", "255 "},
+		{"$-10 .", "-16 "},
+		{"#10 .", "10 "},
+		{"%1010 .", "10 "},
+		{"hex #10 $10 %10 decimal . . .", "2 16 10 "},
+		{"hex '*' decimal .", "42 "},
+		{"hex #1.5 decimal .", "1.5 "},
+		{"hex : h 10 ; decimal h .", "16 "},
+		{"hex ffn decimal .", "255 "},
+		{"255n hex .", "FF "},
+		{"10/3r hex .", "A/3 "},
+		{"2.5 hex .", "2.5 "},
+		{"0 base ! 12 . decimal", "12 "},
+	}
+
+	for _, test := range tests {
+
+		e := New()
+		out := e.CaptureOutput()
+
+		err := e.Eval(test.input)
+		if err != nil {
+			t.Fatalf("unexpected error evaluating '%s': %s", test.input, err.Error())
+		}
+		if out.String() != test.output {
+			t.Fatalf("'%s' gave '%s', not '%s'", test.input, out.String(), test.output)
+		}
+	}
+
+	// Invalid digits are errors
+	errs := []string{"binary 12", "hex 1.5", "hex 1.5r", "hex fg", "$", "$fg", "%2"}
+	for _, test := range errs {
+		e := New()
+		err := e.Eval(test)
+		if err == nil {
+			t.Fatalf("expected error evaluating '%s'", test)
+		}
+	}
+}
+
 func TestMaxMin(t *testing.T) {
 
 	errors := []string{
@@ -454,7 +570,7 @@ func TestSetWriter(t *testing.T) {
 		t.Fatalf("unexpected error")
 	}
 
-	if b.String() != "0/10\n1/10\n2/10\n3/10\n4/10\n5/10\n6/10\n7/10\n8/10\n9/10\n" {
+	if b.String() != "0/10 1/10 2/10 3/10 4/10 5/10 6/10 7/10 8/10 9/10 " {
 		t.Fatalf("STDOUT didn't match, got '%s' for ", b.String())
 	}
 
@@ -506,3 +622,321 @@ func TestStrlenEval(t *testing.T) {
 	}
 
 }
+
+func TestAbort(t *testing.T) {
+
+	type Test struct {
+		input   string
+		message string
+		abort   bool
+	}
+
+	tests := []Test{
+		{input: "1 2 3 abort", message: "", abort: true},
+		{input: "1 0 < abort\" negative\"", abort: false},
+		{input: "-1 0 < abort\" negative\"", message: "negative", abort: true},
+		{input: ": chk 0 < abort\" bad input\" ; 3 chk", abort: false},
+		{input: ": chk 0 < abort\" bad input\" ; -3 chk", message: "bad input", abort: true},
+		{input: ": chk 10 0 do i 5 = if abort then loop ; chk", message: "", abort: true},
+		{input: "1 if abort then 5", message: "", abort: true},
+		{input: "3 0 do i 1 = if abort then loop 5", message: "", abort: true},
+	}
+
+	for _, test := range tests {
+
+		e := New()
+		e.debug = true
+
+		err := e.Eval(test.input)
+		if !test.abort {
+			if err != nil {
+				t.Fatalf("unexpected error processing '%s': %s", test.input, err.Error())
+			}
+			continue
+		}
+
+		var abort *AbortError
+		if !errors.As(err, &abort) {
+			t.Fatalf("%s: expected an abort, got %v", test.input, err)
+		}
+		if abort.Message != test.message {
+			t.Fatalf("%s: expected message '%s', got '%s'", test.input, test.message, abort.Message)
+		}
+		if err == ErrQuit {
+			t.Fatalf("%s: abort should be distinct from quit", test.input)
+		}
+
+		// The state should have been reset
+		if !e.Stack.IsEmpty() {
+			t.Fatalf("%s: expected stack to be empty", test.input)
+		}
+		if len(e.loops) != 0 || e.compiling || e.immediate != 0 {
+			t.Fatalf("%s: expected state to be reset", test.input)
+		}
+	}
+
+	// abort" with an empty stack is an error, but not an abort
+	e := New()
+	err := e.Eval("abort\" empty\"")
+	if err == nil {
+		t.Fatalf("expected error, got none")
+	}
+	if !strings.Contains(err.Error(), "underflow") {
+		t.Fatalf("got an error, but the wrong one: %s", err.Error())
+	}
+}
+
+func TestLimits(t *testing.T) {
+
+	type Test struct {
+		limits Limits
+		input  string
+		err    error
+	}
+
+	tests := []Test{
+		{limits: Limits{MaxInstructions: 100},
+			input: "1000 0 do 1 drop loop",
+			err:   ErrInstructionLimit},
+		{limits: Limits{MaxInstructions: 100},
+			input: ": forever recursive 1 drop forever ; forever",
+			err:   ErrInstructionLimit},
+		{limits: Limits{MaxStackDepth: 10},
+			input: "1000 0 do i loop",
+			err:   ErrStackLimit},
+		{limits: Limits{MaxStackDepth: 10},
+			input: "1 2 3 4 5 6 7 8 9 10 11",
+			err:   ErrStackLimit},
+		{limits: Limits{MaxCallDepth: 50},
+			input: ": forever recursive 1 drop forever ; forever",
+			err:   ErrCallDepthLimit},
+		{limits: Limits{MaxWords: 2},
+			input: ": a ; : b ; : c ;",
+			err:   ErrDictionaryLimit},
+		{limits: Limits{MaxWords: 1},
+			input: "variable x 3 array a : c ;",
+			err:   ErrDictionaryLimit},
+		{limits: Limits{MaxStrings: 2},
+			input: "\"one\" \"two\" \"three\"",
+			err:   ErrStringLimit},
+		{limits: Limits{MaxStringBytes: 10},
+			input: "\"one\" \"two\" \"three\" \"four\"",
+			err:   ErrStringLimit},
+		{limits: Limits{MaxStrings: 2},
+			input: ": foo .\" one\" .\" two\" .\" three\" ;",
+			err:   ErrStringLimit},
+	}
+
+	for _, test := range tests {
+
+		e := New()
+		e.SetLimits(test.limits)
+
+		err := e.Eval(test.input)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%s: expected error '%v', got '%v'", test.input, test.err, err)
+		}
+	}
+
+	// Within the limits everything works as expected
+	e := New()
+	e.SetLimits(Limits{MaxInstructions: 1000, MaxStackDepth: 10, MaxCallDepth: 10})
+
+	err := e.Eval(": factorial recursive  dup 1 > if dup 1 - factorial *  then ; 6 factorial")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	// The instruction-count is per-call
+	for i := 0; i < 100; i++ {
+		err = e.Eval("100 0 do loop")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+	}
+
+	// Only the words we define count towards the dictionary limit,
+	// and running code outside a definition doesn't use them up
+	e = New()
+	e.SetLimits(Limits{MaxWords: 2})
+
+	for i := 0; i < 100; i++ {
+		err = e.Eval("3 0 do loop 1 if then")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+	}
+	err = e.Eval(": a ; : b ;")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	// Strings which are no longer used don't count towards the
+	// limit upon their total length
+	e = New()
+	e.SetLimits(Limits{MaxStringBytes: 10})
+
+	for i := 0; i < 100; i++ {
+		err = e.Eval("\"abcdef\" \"ghi\" s+ drop")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+
+	e := New()
+	err := e.Eval(": star 42 emit ;")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	// A cancelled context stops execution immediately
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = e.EvalContext(ctx, "3 star")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "star") {
+		t.Fatalf("error didn't contain the running word: %s", err.Error())
+	}
+
+	// The stack is retained
+	if e.Stack.Len() != 1 {
+		t.Fatalf("expected the stack to be retained")
+	}
+	e.Stack.Pop()
+
+	// A deadline interrupts a long-running loop
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err = e.EvalContext(ctx, ": spin 1000000000 0 do 1 drop loop ; spin")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline, got %v", err)
+	}
+	if len(e.loops) != 0 {
+		t.Fatalf("expected loops to be discarded")
+	}
+
+	// And the interpreter can be reused afterwards
+	err = e.Eval(": foo 1 3 + ; foo 10 0 do loop")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	ret, err := e.Stack.Pop()
+	if err != nil || ret != 4 {
+		t.Fatalf("unexpected result, post-cancellation")
+	}
+}
+
+func TestBacktrace(t *testing.T) {
+
+	e := New()
+
+	e.SetPosition("test.4th", 10)
+	err := e.Eval(`: inner
+  drop drop ;
+: outer 1 inner ;`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	err = e.Eval("outer")
+	if err == nil {
+		t.Fatalf("expected an error, got none")
+	}
+	if err.Error() != "stack underflow" {
+		t.Fatalf("got an error, but the wrong one: %s", err.Error())
+	}
+
+	var runtime *Error
+	if !errors.As(err, &runtime) {
+		t.Fatalf("expected a backtrace, got %v", err)
+	}
+
+	expected := []string{"drop+0", "inner+1 (test.4th:11)", "outer+2 (test.4th:12)"}
+	if len(runtime.Backtrace) != len(expected) {
+		t.Fatalf("unexpected backtrace: %v", runtime.Backtrace)
+	}
+	for i, frame := range runtime.Backtrace {
+		if frame.String() != expected[i] {
+			t.Fatalf("unexpected frame %d: %s != %s", i, frame, expected[i])
+		}
+	}
+
+	// Without a position the lines are relative to the input
+	e.Reset()
+	err = e.Eval("\n: bad 1 + ; bad")
+	if !errors.As(err, &runtime) {
+		t.Fatalf("expected a backtrace, got %v", err)
+	}
+	if runtime.Backtrace[1].String() != "bad+2 (line 2)" {
+		t.Fatalf("unexpected frame: %s", runtime.Backtrace[1])
+	}
+
+	// The frames are gone once we've returned
+	if len(e.Frames()) != 0 {
+		t.Fatalf("frames remain after an error")
+	}
+}
+
+func TestWriters(t *testing.T) {
+
+	var errs, dbg bytes.Buffer
+
+	e := New()
+	out := e.CaptureOutput()
+	e.SetErrorOutput(&errs)
+	e.SetDebugOutput(&dbg)
+
+	// words and dump go to STDOUT
+	err := e.Eval(": star 42 emit ; words")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if !strings.Contains(out.String(), "star") || !strings.Contains(out.String(), "emit") {
+		t.Fatalf("words output wasn't captured: %s", out.String())
+	}
+
+	out.Reset()
+	e.Stack.Push(float64(e.findWord("star")))
+	err = e.Eval("dump")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if out.String() != "Word 'star'\n 0: store 42\n 2: emit\n" {
+		t.Fatalf("dump output wasn't captured: %s", out.String())
+	}
+
+	// An invalid index is a diagnostic
+	out.Reset()
+	err = e.Eval("-1 dump")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if out.String() != "" || errs.String() != "Invalid index\n" {
+		t.Fatalf("unexpected output: '%s' '%s'", out.String(), errs.String())
+	}
+
+	// Debug messages go to their own writer
+	if dbg.String() != "" {
+		t.Fatalf("unexpected debug output: %s", dbg.String())
+	}
+	err = e.Eval("1 debug : twice 2 * ; 3 twice star")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if !strings.Contains(dbg.String(), "Word 'twice'") || !strings.Contains(dbg.String(), "calling built-in word emit") {
+		t.Fatalf("unexpected debug output: %s", dbg.String())
+	}
+	if strings.Contains(out.String(), "calling") {
+		t.Fatalf("debug output went to STDOUT: %s", out.String())
+	}
+	if out.String() != "*" {
+		t.Fatalf("unexpected output: %s", out.String())
+	}
+}
@@ -0,0 +1,223 @@
+// This file contains the formatting of floating-point numbers, which
+// may be shown in general, fixed, scientific, or engineering notation.
+//
+// The number of digits shown is controlled by the precision, which
+// may be changed via `set-precision`, and the notation used by `.`
+// and `f.` may be chosen by the host-application via SetFloatFormat.
+
+package eval
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// FloatFormat describes the notation used to show floating-point numbers.
+type FloatFormat int
+
+const (
+	// FloatGeneral shows integral values without a fractional part,
+	// and other values in fixed notation with any trailing zeros
+	// removed - unless they are very large, or very small, in which
+	// case scientific notation is used.
+	//
+	// Until `set-precision` is called the shortest representation
+	// which reads back as the same number is shown.
+	FloatGeneral FloatFormat = iota
+
+	// FloatFixed shows numbers with precision digits after the
+	// decimal point, for example "1234.500000".
+	FloatFixed
+
+	// FloatScientific shows numbers with precision significant
+	// digits, and a single digit before the decimal point, for
+	// example "1.23450e+03".
+	FloatScientific
+
+	// FloatEngineering is like FloatScientific, except the exponent
+	// is always a multiple of three, for example "12.3450e+03".
+	FloatEngineering
+)
+
+// defaultPrecision is the precision used until `set-precision` is called.
+const defaultPrecision = 6
+
+// maxPrecision is the largest precision which is useful, given that
+// a float64 holds roughly seventeen significant digits.
+const maxPrecision = 17
+
+// SetFloatFormat chooses the notation `.`, and `f.`, use to show
+// floating-point numbers.  The default is FloatGeneral.
+//
+// This is designed to be used by host-applications which embed this
+// library.
+func (e *Eval) SetFloatFormat(format FloatFormat) {
+	e.floatFormat = format
+}
+
+// formatFloat returns the given number, in the given notation.
+func (e *Eval) formatFloat(n float64, format FloatFormat) string {
+
+	switch {
+	case math.IsNaN(n):
+		return "NaN"
+	case math.IsInf(n, 1):
+		return "Inf"
+	case math.IsInf(n, -1):
+		return "-Inf"
+	}
+
+	switch format {
+	case FloatFixed:
+		return strconv.FormatFloat(n, 'f', e.precision, 64)
+	case FloatScientific:
+		return strconv.FormatFloat(n, 'e', e.significant()-1, 64)
+	case FloatEngineering:
+		return e.formatEngineering(n)
+	}
+
+	// Very large, and very small, numbers are unreadable in fixed
+	// notation, so show them in scientific notation - without any
+	// trailing zeros.
+	abs := math.Abs(n)
+	if abs >= 1e15 || (abs != 0 && abs < 1e-4) {
+		digits := -1
+		if e.precisionSet {
+			digits = e.significant() - 1
+		}
+		mantissa, exponent := splitExponent(strconv.FormatFloat(n, 'e', digits, 64))
+		return trimZeros(mantissa) + "e" + exponent
+	}
+
+	// If the value is an integer then show it as one - i.e.
+	// without any ".00000".
+	if n == math.Trunc(n) {
+		return strconv.FormatFloat(n, 'f', 0, 64)
+	}
+
+	// If no precision has been chosen show the shortest
+	// representation, rather than the noise from the binary
+	// expansion of the number.
+	if !e.precisionSet {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+
+	// Otherwise show it, but remove any trailing "0".
+	//
+	// This means we get 1.25 instead of 1.2500000 shown
+	// when the user runs `5 4 / .`.
+	return trimZeros(strconv.FormatFloat(n, 'f', e.precision, 64))
+}
+
+// formatEngineering returns the given number in engineering notation,
+// which is scientific notation with the exponent restricted to a
+// multiple of three.
+func (e *Eval) formatEngineering(n float64) string {
+
+	// Start with scientific notation, so the rounding is done for
+	// us, and then move the decimal point to the right as needed.
+	str := strconv.FormatFloat(n, 'e', e.significant()-1, 64)
+	mantissa, exp := splitExponent(str)
+	exponent, _ := strconv.Atoi(exp)
+
+	sign := ""
+	if strings.HasPrefix(mantissa, "-") {
+		sign = "-"
+		mantissa = mantissa[1:]
+	}
+	digits := strings.Replace(mantissa, ".", "", 1)
+
+	shift := exponent % 3
+	if shift < 0 {
+		shift += 3
+	}
+	if n == 0 {
+		shift = 0
+	}
+	for len(digits) < shift+1 {
+		digits += "0"
+	}
+
+	str = sign + digits[:shift+1]
+	if len(digits) > shift+1 {
+		str += "." + digits[shift+1:]
+	}
+	return str + fmt.Sprintf("e%+03d", exponent-shift)
+}
+
+// significant returns the number of significant digits to show in
+// scientific, and engineering, notation.
+func (e *Eval) significant() int {
+	if e.precision < 1 {
+		return 1
+	}
+	return e.precision
+}
+
+// splitExponent splits a number in scientific notation into its mantissa,
+// and its exponent.
+func splitExponent(str string) (string, string) {
+	idx := strings.Index(str, "e")
+	if idx < 0 {
+		return str, ""
+	}
+	return str[:idx], str[idx+1:]
+}
+
+// trimZeros removes trailing zeros after a decimal point, along with the
+// point itself if nothing follows it.
+func trimZeros(str string) string {
+	if !strings.Contains(str, ".") {
+		return str
+	}
+	str = strings.TrimRight(str, "0")
+	return strings.TrimSuffix(str, ".")
+}
+
+// fprintEngineering outputs the number on the top of the floating-point
+// stack in engineering notation.
+func (e *Eval) fprintEngineering() error {
+	return e.fprintFormat(FloatEngineering)
+}
+
+// fprintScientific outputs the number on the top of the floating-point
+// stack in scientific notation.
+func (e *Eval) fprintScientific() error {
+	return e.fprintFormat(FloatScientific)
+}
+
+// fprintFormat outputs the number on the top of the floating-point stack
+// in the given notation, in the same way as `f.`.
+func (e *Eval) fprintFormat(format FloatFormat) error {
+	n, err := e.popFloat()
+	if err != nil {
+		return err
+	}
+	e.printString(e.formatFloat(n.Float(), format))
+	e.dotSeparator()
+	return nil
+}
+
+// getPrecision pushes the current precision.
+func (e *Eval) getPrecision() error {
+	e.Stack.PushInt(int64(e.precision))
+	return nil
+}
+
+// setPrecision changes the precision, which is the number of digits
+// shown after the decimal point in fixed notation, and the number of
+// significant digits shown in scientific, and engineering, notation.
+func (e *Eval) setPrecision() error {
+	n, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	if n < 0 || n > maxPrecision {
+		return fmt.Errorf("invalid precision %d, must be between 0 and %d", n, maxPrecision)
+	}
+	e.precision = int(n)
+	e.precisionSet = true
+	return nil
+}
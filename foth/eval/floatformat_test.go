@@ -0,0 +1,118 @@
+package eval
+
+import (
+	"testing"
+)
+
+func TestFloatFormat(t *testing.T) {
+
+	type TestCase struct {
+		input  string
+		output string
+	}
+
+	tests := []TestCase{
+		// general notation
+		{"1 3 / .", "0.3333333333333333 "},
+		{"123456789012345.6 .", "123456789012345.6 "},
+		{"0.1 .", "0.1 "},
+		{"5 4 / .", "1.25 "},
+		{"1234567 s>f f.", "1234567 "},
+		{"1e20 .", "1e+20 "},
+		{"-1e20 .", "-1e+20 "},
+		{"1.5e-9 .", "1.5e-09 "},
+		{"0.0001 .", "0.0001 "},
+		{"1 s>f 0 s>f f/ f.", "Inf "},
+		{"-1 s>f 0 s>f f/ f.", "-Inf "},
+		{"-1 sqrt .", "NaN "},
+		{"1.5 >f f.", "1.5 "},
+
+		// engineering notation
+		{"12345 >f fe.", "12.3450e+03 "},
+		{"-1234 >f fe.", "-1.23400e+03 "},
+		{"0.00012345 >f fe.", "123.450e-06 "},
+		{"999999 >f fe.", "999.999e+03 "},
+		{"9999999 >f fe.", "10.0000e+06 "},
+		{"0 >f fe.", "0.00000e+00 "},
+		{"-1 sqrt >f fe.", "NaN "},
+
+		// scientific notation
+		{"12345 >f fs.", "1.23450e+04 "},
+		{"0.00012345 >f fs.", "1.23450e-04 "},
+		{"0 ln >f fs.", "-Inf "},
+
+		// precision
+		{"precision .", "6 "},
+		{"3 set-precision precision .", "3 "},
+		{"3 set-precision 1 3 / .", "0.333 "},
+		{"3 set-precision 12345 >f fe.", "12.3e+03 "},
+		{"3 set-precision 12345 >f fs.", "1.23e+04 "},
+		{"1 set-precision 12345 >f fe.", "10e+03 "},
+		{"0 set-precision 2 3 / .", "1 "},
+		{"0 set-precision 12345 >f fs.", "1e+04 "},
+	}
+
+	for _, test := range tests {
+
+		e := New()
+		out := e.CaptureOutput()
+
+		err := e.Eval(test.input)
+		if err != nil {
+			t.Fatalf("unexpected error evaluating '%s': %s", test.input, err.Error())
+		}
+		if out.String() != test.output {
+			t.Fatalf("'%s' gave '%s', not '%s'", test.input, out.String(), test.output)
+		}
+	}
+}
+
+func TestSetFloatFormat(t *testing.T) {
+
+	type TestCase struct {
+		format FloatFormat
+		output string
+	}
+
+	tests := []TestCase{
+		{FloatGeneral, "1234.5 7 "},
+		{FloatFixed, "1234.500000 7 "},
+		{FloatScientific, "1.23450e+03 7 "},
+		{FloatEngineering, "1.23450e+03 7 "},
+	}
+
+	for _, test := range tests {
+
+		e := New()
+		e.SetFloatFormat(test.format)
+		out := e.CaptureOutput()
+
+		// integers are unaffected
+		err := e.Eval("1234.5 >f f. 7 .")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		if out.String() != test.output {
+			t.Fatalf("format %d gave '%s', not '%s'", test.format, out.String(), test.output)
+		}
+	}
+}
+
+func TestPrecisionErrors(t *testing.T) {
+
+	tests := []string{
+		"set-precision",
+		"-1 set-precision",
+		"18 set-precision",
+		"fe.",
+		"fs.",
+	}
+
+	for _, test := range tests {
+		e := New()
+		err := e.Eval(test)
+		if err == nil {
+			t.Fatalf("expected an error evaluating '%s'", test)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+// This file contains the floating-point word set.
+//
+// Floating-point numbers used by these words live upon a separate stack,
+// so that scripts can mix integer indexes and floating-point maths without
+// juggling them.  Numbers are moved between the two stacks with `>f` and
+// `f>`, or converted as they're moved with `s>f` and `f>s`.
+//
+// Literals are pushed to the stack, like any other number, so when the
+// floating-point stack is empty these words take their arguments from the
+// stack instead.  This allows `1.5 2.5 f+ f.` to work as expected.
+
+package eval
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/skx/foth/foth/stack"
+)
+
+// PushFloat adds a number to the top of the floating-point stack.
+//
+// This is designed to be used by host-applications which embed
+// this library.
+func (e *Eval) PushFloat(f float64) {
+	e.FStack.Push(f)
+}
+
+// PopFloat removes, and returns, the number on the top of the
+// floating-point stack.
+//
+// This is designed to be used by host-applications which embed
+// this library.
+func (e *Eval) PopFloat() (float64, error) {
+	return e.FStack.Pop()
+}
+
+// popFloat removes the number on the top of the floating-point stack, and
+// returns it.  If the floating-point stack is empty then the number on the
+// top of the stack is used instead.
+func (e *Eval) popFloat() (stack.Cell, error) {
+	if !e.FStack.IsEmpty() {
+		return e.FStack.PopCell()
+	}
+	c, err := e.Stack.PopCell()
+	if err != nil {
+		return c, err
+	}
+	if c.IsReference() {
+		return c, fmt.Errorf("%s is not a number", c)
+	}
+	return stack.FloatCell(c.Float()), nil
+}
+
+// fbinOp pops two numbers from the floating-point stack, and pushes the
+// result of calling the given function upon them.
+//
+// Note that the top-most number is the first argument.
+func (e *Eval) fbinOp(op func(float64, float64) float64) func() error {
+	return func() error {
+		a, err := e.popFloat()
+		if err != nil {
+			return err
+		}
+
+		b, err := e.popFloat()
+		if err != nil {
+			return err
+		}
+
+		e.FStack.Push(op(a.Float(), b.Float()))
+		return nil
+	}
+}
+
+func (e *Eval) fadd() error {
+	return e.fbinOp(func(n float64, m float64) float64 { return m + n })()
+}
+
+// fconstant defines a word, with the name which follows, that pushes the
+// number on the top of the floating-point stack.
+func (e *Eval) fconstant() error {
+	val, err := e.popFloat()
+	if err != nil {
+		return err
+	}
+
+	e.defining = func(name string) error {
+		if e.debug {
+			e.debugf("defining floating-point constant %s\n", name)
+		}
+
+		// is the name used?  If so remove it
+		idx := e.findWord(name)
+		if idx != -1 {
+			e.Dictionary[idx].Name = ""
+		}
+
+		return e.addWord(Word{
+			Name: strings.ToLower(name),
+			Function: func() error {
+				e.FStack.PushCell(val)
+				return nil
+			},
+		})
+	}
+	return nil
+}
+
+func (e *Eval) fdiv() error {
+	return e.fbinOp(func(n float64, m float64) float64 { return m / n })()
+}
+
+func (e *Eval) fdrop() error {
+	_, err := e.FStack.Pop()
+	return err
+}
+
+func (e *Eval) fdup() error {
+	a, err := e.FStack.Pop()
+	if err != nil {
+		return err
+	}
+	e.FStack.Push(a)
+	e.FStack.Push(a)
+	return nil
+}
+
+// ffetch pushes the value at the given address onto the floating-point
+// stack.
+func (e *Eval) ffetch() error {
+	addr, err := e.popAddr()
+	if err != nil {
+		return err
+	}
+	e.FStack.Push(e.memory[addr].Float())
+	return nil
+}
+
+// fromFloat moves a number from the floating-point stack to the stack.
+func (e *Eval) fromFloat() error {
+	a, err := e.FStack.Pop()
+	if err != nil {
+		return err
+	}
+	e.Stack.Push(a)
+	return nil
+}
+
+func (e *Eval) flt() error {
+	a, err := e.popFloat()
+	if err != nil {
+		return err
+	}
+	b, err := e.popFloat()
+	if err != nil {
+		return err
+	}
+	if b.Float() < a.Float() {
+		e.Stack.PushInt(1)
+	} else {
+		e.Stack.PushInt(0)
+	}
+	return nil
+}
+
+func (e *Eval) fmul() error {
+	return e.fbinOp(func(n float64, m float64) float64 { return m * n })()
+}
+
+func (e *Eval) fover() error {
+	a, err := e.FStack.Pop()
+	if err != nil {
+		return err
+	}
+	b, err := e.FStack.Pop()
+	if err != nil {
+		return err
+	}
+
+	e.FStack.Push(b)
+	e.FStack.Push(a)
+	e.FStack.Push(b)
+	return nil
+}
+
+// fprint outputs the number on the top of the floating-point stack, in
+// the same way as `.`.
+func (e *Eval) fprint() error {
+	n, err := e.popFloat()
+	if err != nil {
+		return err
+	}
+	e.printNumber(n)
+	e.dotSeparator()
+	return nil
+}
+
+// fstore stores the number on the top of the floating-point stack
+// at the given address.
+func (e *Eval) fstore() error {
+	addr, err := e.popAddr()
+	if err != nil {
+		return err
+	}
+	value, err := e.popFloat()
+	if err != nil {
+		return err
+	}
+	e.store(addr, value)
+	return nil
+}
+
+func (e *Eval) fsub() error {
+	return e.fbinOp(func(n float64, m float64) float64 { return m - n })()
+}
+
+func (e *Eval) fswap() error {
+	b, err := e.FStack.Pop()
+	if err != nil {
+		return err
+	}
+	a, err := e.FStack.Pop()
+	if err != nil {
+		return err
+	}
+	e.FStack.Push(b)
+	e.FStack.Push(a)
+	return nil
+}
+
+// fvariable defines a variable, with the name which follows, which holds
+// a floating-point number.
+func (e *Eval) fvariable() error {
+	e.defining = func(name string) error {
+		if e.debug {
+			e.debugf("defining floating-point variable %s\n", name)
+		}
+		return e.addVariable(name, stack.FloatCell(0))
+	}
+	return nil
+}
+
+func (e *Eval) fzeroEq() error {
+	a, err := e.popFloat()
+	if err != nil {
+		return err
+	}
+	if a.Float() == 0 {
+		e.Stack.PushInt(1)
+	} else {
+		e.Stack.PushInt(0)
+	}
+	return nil
+}
+
+// toFloat moves a number from the stack to the floating-point stack.
+func (e *Eval) toFloat() error {
+	a, err := e.Stack.Pop()
+	if err != nil {
+		return err
+	}
+	e.FStack.Push(a)
+	return nil
+}
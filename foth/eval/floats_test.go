@@ -0,0 +1,157 @@
+package eval
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFloatHost(t *testing.T) {
+
+	e := New()
+
+	_, err := e.PopFloat()
+	if err == nil {
+		t.Fatalf("expected error with empty stack")
+	}
+
+	e.PushFloat(1.5)
+	e.PushFloat(2.25)
+
+	err = e.Eval("f+")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	out, err := e.PopFloat()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if out != 3.75 {
+		t.Fatalf("wrong result: %f", out)
+	}
+	if !e.Stack.IsEmpty() {
+		t.Fatalf("the stack should not have been touched")
+	}
+}
+
+func TestFloatWords(t *testing.T) {
+
+	type TestCase struct {
+		input  string
+		output string
+	}
+
+	tests := []TestCase{
+		{"1.5 >f 2 >f f+ f.", "3.5 "},
+		{"5 >f 2 >f f- f.", "3 "},
+		{"5 >f 2 >f f* f.", "10 "},
+		{"5 >f 2 >f f/ f.", "2.5 "},
+		{"3 >f fdup f* f.", "9 "},
+		{"1 >f 2 >f fdrop f.", "1 "},
+		{"1 >f 2 >f fswap f. f.", "1 2 "},
+		{"1 >f 2 >f fover f. f. f.", "1 2 1 "},
+		{"1 >f 2 >f f< .", "1 "},
+		{"2 >f 1 >f f< .", "0 "},
+		{"0 >f f0= . 1 >f f0= .", "1 0 "},
+		{"2.5 >f f> .", "2.5 "},
+		{"fvariable x 1.25 >f x f! x f@ f.", "1.25 "},
+		{"fvariable y y f@ f.", "0 "},
+		{"3.5 >f fconstant pi-ish pi-ish pi-ish f+ f.", "7 "},
+		{": area fdup f* ; 3 >f area f.", "9 "},
+
+		// integers and floats don't interfere
+		{"10 1.5 >f 2.5 >f f+ f> + .", "14 "},
+
+		// s>f and f>s move numbers between the stacks
+		{"3 s>f 2 s>f f+ f.", "5 "},
+		{"3 s>f f> .", "3 "},
+		{"3.9 >f f>s .", "3 "},
+		{"7 s>f 2 s>f f- f>s .", "5 "},
+
+		// literals may be used when the floating-point stack is empty
+		{"1.5 2.5 f+ f.", "4 "},
+		{"5 2 f- f.", "3 "},
+		{"1 2 f< .", "1 "},
+		{"0 f0= .", "1 "},
+		{"1.25 f.", "1.25 "},
+		{"3.9 f>s .", "3 "},
+		{"fvariable x 1.5 x f! x f@ f.", "1.5 "},
+		{"2.5 fconstant c c c f* f.", "6.25 "},
+	}
+
+	for _, test := range tests {
+
+		e := New()
+		out := e.CaptureOutput()
+
+		err := e.Eval(test.input)
+		if err != nil {
+			t.Fatalf("unexpected error evaluating '%s': %s", test.input, err.Error())
+		}
+		if out.String() != test.output {
+			t.Fatalf("'%s' gave '%s', not '%s'", test.input, out.String(), test.output)
+		}
+		if !e.Stack.IsEmpty() || !e.FStack.IsEmpty() {
+			t.Fatalf("'%s' left items on the stacks", test.input)
+		}
+	}
+}
+
+func TestFloatErrors(t *testing.T) {
+
+	tests := []string{
+		"f+",
+		"1 >f f+",
+		"f-",
+		"f*",
+		"f/",
+		"fdup",
+		"fdrop",
+		"fswap",
+		"1 >f fswap",
+		"fover",
+		"1 >f fover",
+		"f.",
+		"f<",
+		"1 >f f<",
+		"f0=",
+		"f>",
+		">f",
+		"fconstant x",
+		"f@",
+		"f!",
+		"3 f@",
+		"variable x x f!",
+		"3 array a a f.",
+		"map m 1 m f+",
+		"3 array a a s>f",
+		"s>f",
+		"f>s",
+	}
+
+	for _, test := range tests {
+		e := New()
+		err := e.Eval(test)
+		if err == nil {
+			t.Fatalf("expected an error evaluating '%s'", test)
+		}
+	}
+}
+
+func TestFloatReset(t *testing.T) {
+
+	e := New()
+	e.PushFloat(3)
+	e.Reset()
+
+	if !e.FStack.IsEmpty() {
+		t.Fatalf("reset should clear the floating-point stack")
+	}
+
+	// The limits apply to both stacks
+	e.SetLimits(Limits{MaxStackDepth: 2})
+	err := e.Eval("1 >f 2 >f 3 >f")
+	if !errors.Is(err, ErrStackLimit) {
+		t.Fatalf("expected stack limit, got %v", err)
+	}
+}
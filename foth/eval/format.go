@@ -0,0 +1,163 @@
+// This file contains the `format` and `printf` words, which build
+// strings in the style of golang's fmt.Sprintf.
+//
+// The format string is on the top of the stack, and the arguments below
+// it, in the order they appear within the format:
+//
+//	"Steve" 42 "%s is %d years old\n" printf
+//
+// A subset of the golang verbs is supported:
+//
+//	%d %x %X %o %b  an integer, in decimal, hex, octal, or binary
+//	%f %e %g        a floating-point number
+//	%s              a string reference
+//	%c              a character code
+//	%v              a number, shown as `.` would show it
+//	%%              a literal percent-sign
+//
+// The verbs may be given flags ("-", "+", " ", "0", and "#"), a width,
+// and a precision, as with golang.  For example "%-8s|" or "%08.3f".
+
+package eval
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/skx/foth/foth/stack"
+)
+
+// formatVerb describes a single verb within a format string.
+type formatVerb struct {
+	// spec holds the verb, including any flags, width, and precision.
+	spec string
+
+	// verb holds the verb character itself.
+	verb byte
+}
+
+// parseFormat splits a format string into the literal text, and the
+// verbs which follow each piece of it.
+//
+// There is always one more piece of text than there are verbs.
+func parseFormat(format string) ([]string, []formatVerb, error) {
+	var text []string
+	var verbs []formatVerb
+
+	var cur strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			cur.WriteByte(format[i])
+			continue
+		}
+
+		// Skip over the flags, width, and precision.
+		j := i + 1
+		for j < len(format) && strings.IndexByte("-+ #0123456789.", format[j]) >= 0 {
+			j++
+		}
+		if j >= len(format) {
+			return nil, nil, fmt.Errorf("format: missing verb at the end of '%s'", format)
+		}
+
+		verb := format[j]
+		switch verb {
+		case '%':
+			cur.WriteByte('%')
+		case 'd', 'x', 'X', 'o', 'b', 'f', 'e', 'g', 's', 'c', 'v':
+			text = append(text, cur.String())
+			cur.Reset()
+			verbs = append(verbs, formatVerb{spec: format[i : j+1], verb: verb})
+		default:
+			return nil, nil, fmt.Errorf("format: unsupported verb '%%%c'", verb)
+		}
+		i = j
+	}
+	text = append(text, cur.String())
+
+	return text, verbs, nil
+}
+
+// formatArg formats a single argument with the given verb.
+func (e *Eval) formatArg(v formatVerb, c stack.Cell) (string, error) {
+	switch v.verb {
+	case 'd', 'x', 'X', 'o', 'b':
+		if c.Kind == stack.BigInt {
+			return fmt.Sprintf(v.spec, c.B), nil
+		}
+		n, err := toInt(c)
+		if err != nil {
+			return "", fmt.Errorf("format: %s", err)
+		}
+		return fmt.Sprintf(v.spec, n), nil
+	case 'c':
+		n, err := toInt(c)
+		if err != nil {
+			return "", fmt.Errorf("format: %s", err)
+		}
+		return fmt.Sprintf(v.spec, rune(n)), nil
+	case 's':
+		str, err := e.getString(c)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(v.spec, str), nil
+	case 'v':
+		spec := v.spec[:len(v.spec)-1] + "s"
+		return fmt.Sprintf(spec, e.formatNumber(c)), nil
+	}
+	return fmt.Sprintf(v.spec, c.Float()), nil
+}
+
+// formatString pops a format string, and the arguments it requires, from
+// the stack and returns the result of formatting them.
+func (e *Eval) formatString() (string, error) {
+	format, err := e.popString()
+	if err != nil {
+		return "", err
+	}
+
+	text, verbs, err := parseFormat(format)
+	if err != nil {
+		return "", err
+	}
+
+	if e.Stack.Len() < len(verbs) {
+		return "", fmt.Errorf("format: '%s' requires %d arguments", format, len(verbs))
+	}
+	args := make([]stack.Cell, len(verbs))
+	copy(args, e.Stack[e.Stack.Len()-len(verbs):])
+	e.Stack = e.Stack[:e.Stack.Len()-len(verbs)]
+
+	var out strings.Builder
+	for i, v := range verbs {
+		out.WriteString(text[i])
+		str, err := e.formatArg(v, args[i])
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(str)
+	}
+	out.WriteString(text[len(verbs)])
+
+	return out.String(), nil
+}
+
+// format builds a new string from a format string, and arguments.
+func (e *Eval) format() error {
+	str, err := e.formatString()
+	if err != nil {
+		return err
+	}
+	return e.pushString(str)
+}
+
+// printf outputs the result of formatting a format string, and arguments.
+func (e *Eval) printf() error {
+	str, err := e.formatString()
+	if err != nil {
+		return err
+	}
+	e.printString(str)
+	return nil
+}
@@ -0,0 +1,84 @@
+package eval
+
+import (
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+
+	type TestCase struct {
+		input  string
+		output string
+	}
+
+	tests := []TestCase{
+		{`"no verbs" printf`, "no verbs"},
+		{`"100%%" printf`, "100%"},
+		{`42 "%d" printf`, "42"},
+		{`42 "[%5d]" printf`, "[   42]"},
+		{`42 "[%-5d]" printf`, "[42   ]"},
+		{`42 "[%05d]" printf`, "[00042]"},
+		{`42 "%+d" printf`, "+42"},
+		{`255 "%x %X %o %b" 3 0 do over swap loop printf`, "ff FF 377 11111111"},
+		{`255 "%#x" printf`, "0xff"},
+		{`4.0 "%d" printf`, "4"},
+		{`12345678901234567890n "%d" printf`, "12345678901234567890"},
+		{`1 3 / "%.3f" printf`, "0.333"},
+		{`2 "%8.2f|" printf`, "    2.00|"},
+		{`12345.678 "%e" printf`, "1.234568e+04"},
+		{`0.5 "%g" printf`, "0.5"},
+		{`1/3r "%.2f" printf`, "0.33"},
+		{`"Steve" "Hello, %s!" printf`, "Hello, Steve!"},
+		{`"ab" "[%-4s][%4s]" over swap printf`, "[ab  ][  ab]"},
+		{`65 "%c%c" over 1 + swap printf`, "AB"},
+		{`1 2 / "%v" printf`, "0.5"},
+		{`2/3r "%v" printf`, "2/3"},
+		{`hex ff "%v %d" over swap printf decimal`, "FF 255"},
+		{`"Steve" 42 "%s is %d" printf`, "Steve is 42"},
+		{`"Steve" 42 "%s is %d" format strprn`, "Steve is 42"},
+		{`1 2 3 "%d-%d" format strprn .`, "2-31 "},
+	}
+
+	for _, test := range tests {
+
+		e := New()
+		out := e.CaptureOutput()
+
+		err := e.Eval(test.input)
+		if err != nil {
+			t.Fatalf("unexpected error evaluating '%s': %s", test.input, err.Error())
+		}
+		if out.String() != test.output {
+			t.Fatalf("'%s' gave '%s', not '%s'", test.input, out.String(), test.output)
+		}
+		if !e.Stack.IsEmpty() {
+			t.Fatalf("'%s' left items on the stack", test.input)
+		}
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+
+	tests := []string{
+		"format",
+		"printf",
+		"42 printf",
+		`"%d" printf`,
+		`1 "%d %d" printf`,
+		`1.5 "%d" printf`,
+		`1/3r "%d" printf`,
+		`1.5 "%c" printf`,
+		`1 "%q" printf`,
+		`1 "%5" printf`,
+		`100 "%s" printf`,
+		`100 "%s" format`,
+	}
+
+	for _, test := range tests {
+		e := New()
+		err := e.Eval(test)
+		if err == nil {
+			t.Fatalf("expected an error evaluating '%s'", test)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// This file contains our support for local variables, which are declared
+// at the start of a definition:
+//
+//	: hypot {: a b -- c :} a a * b b * + sqrt ;
+//
+// The names before `|` are initialised from the stack, with the last of
+// them taking the topmost value, while those after it start as zero.
+// Anything following `--` is a comment.  The gforth form, `{ a b -- c }`,
+// is also accepted.
+//
+// Using the name of a local pushes its value, and `to NAME` stores the
+// topmost value within it.  Every invocation of a word has its own
+// locals, so recursive words don't overwrite each other's.
+
+package eval
+
+import (
+	"fmt"
+	"strings"
+)
+
+// localsState describes the part of a locals declaration we're within.
+type localsState int
+
+const (
+	// localsArgs are initialised from the stack.
+	localsArgs localsState = iota
+
+	// localsTemps follow `|`, and are initialised to zero.
+	localsTemps
+
+	// localsOutputs follow `--`, and are ignored.
+	localsOutputs
+)
+
+// localsDecl holds the state of the locals declaration we're compiling.
+type localsDecl struct {
+	// close is the token which ends the declaration.
+	close string
+
+	// state is the part of the declaration we're within.
+	state localsState
+
+	// args holds the indexes of the locals which are initialised from
+	// the stack, in the order they were declared.
+	args []int
+}
+
+// findLocal returns the index of the specified local variable, within
+// the word we're compiling, or -1 if it cannot be found.
+func (e *Eval) findLocal(name string) int {
+	name = strings.ToLower(name)
+	for i, l := range e.tmp.Locals {
+		if l == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// compileLocals handles the declaration, and use, of local variables
+// within the word we're compiling.
+//
+// It returns true if the token was handled.
+func (e *Eval) compileLocals(tok string) (bool, error) {
+	name := strings.ToLower(tok)
+
+	if e.declaring != nil {
+		return true, e.declareLocal(name)
+	}
+
+	if e.localTo {
+		e.localTo = false
+
+		idx := e.findLocal(name)
+		if idx < 0 {
+			return true, fmt.Errorf("to: %s is not a local variable", tok)
+		}
+		e.compile(-13)
+		e.compile(float64(idx))
+		return true, nil
+	}
+
+	switch name {
+	case "{:", "{":
+		if !e.compiling {
+			return true, fmt.Errorf("locals may only be declared within a definition")
+		}
+		close := ":}"
+		if name == "{" {
+			close = "}"
+		}
+		e.declaring = &localsDecl{close: close, state: localsArgs}
+		return true, nil
+	case "to":
+		e.localTo = true
+		return true, nil
+	}
+
+	idx := e.findLocal(name)
+	if idx >= 0 {
+		e.compile(-12)
+		e.compile(float64(idx))
+		return true, nil
+	}
+	return false, nil
+}
+
+// declareLocal handles a token within a locals declaration.
+func (e *Eval) declareLocal(name string) error {
+	decl := e.declaring
+
+	switch name {
+	case decl.close:
+		// Initialise the arguments from the stack, the last
+		// of which is the topmost value.
+		for i := len(decl.args) - 1; i >= 0; i-- {
+			e.compile(-13)
+			e.compile(float64(decl.args[i]))
+		}
+		e.declaring = nil
+		return nil
+	case "|":
+		if decl.state != localsArgs {
+			return fmt.Errorf("unexpected '|' in locals declaration")
+		}
+		decl.state = localsTemps
+		return nil
+	case "--":
+		decl.state = localsOutputs
+		return nil
+	case ";", "{:", "{", ":}", "}":
+		return fmt.Errorf("unterminated locals declaration, expected '%s' not '%s'", decl.close, name)
+	}
+
+	if decl.state == localsOutputs {
+		return nil
+	}
+	if e.findLocal(name) >= 0 {
+		return fmt.Errorf("local variable %s is already declared", name)
+	}
+
+	e.tmp.Locals = append(e.tmp.Locals, name)
+	if decl.state == localsArgs {
+		decl.args = append(decl.args, len(e.tmp.Locals)-1)
+	}
+	return nil
+}
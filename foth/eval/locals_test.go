@@ -0,0 +1,105 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLocals(t *testing.T) {
+
+	type TestCase struct {
+		input  string
+		output string
+	}
+
+	tests := []TestCase{
+		{": f {: a b -- c :} a b - ; 10 3 f .", "7 "},
+		{": f { a b -- } b a ; 1 2 f . .", "1 2 "},
+		{": f { a } a a * ; 1.5 f .", "2.25 "},
+		{": f { A } a ; 2 f .", "2 "},
+
+		// uninitialised locals start as zero
+		{": f {: | x :} x ; f .", "0 "},
+		{": f {: a | t -- :} t . a 2 * to t t . ; 5 f", "0 10 "},
+
+		// locals may be updated
+		{": f { a } a 1 + to a a ; 4 f .", "5 "},
+		{": sum { n | total } n 0 do i total + to total loop total ; 4 sum .", "6 "},
+
+		// locals hide words of the same name
+		{": f { dup } dup dup * ; 3 f .", "9 "},
+
+		// each invocation has its own locals
+		{": g { a } a 10 * ; : f { a } a g a + ; 1 f .", "11 "},
+		{": fib recursive { n } n 2 < if n else n 1 - fib n 2 - fib + then ; 10 fib .", "55 "},
+
+		// strings held in locals are kept alive
+		{": f { s } 100 0 do \"x\" \"y\" s+ drop loop s strprn ; \"kept\" \"\" s+ f", "kept"},
+	}
+
+	for _, test := range tests {
+
+		e := New()
+		out := e.CaptureOutput()
+
+		err := e.Eval(test.input)
+		if err != nil {
+			t.Fatalf("unexpected error evaluating '%s': %s", test.input, err.Error())
+		}
+		if out.String() != test.output {
+			t.Fatalf("'%s' gave '%s', not '%s'", test.input, out.String(), test.output)
+		}
+		if !e.Stack.IsEmpty() {
+			t.Fatalf("'%s' left items on the stack", test.input)
+		}
+	}
+}
+
+func TestLocalsErrors(t *testing.T) {
+
+	tests := []string{
+		"{ a }",
+		"1 if { a } then",
+		": f { a a } ;",
+		": f { a ;",
+		": f {: a } ;",
+		": f { a { b } } ;",
+		": f { a -- b | c } ;",
+		": f to x ;",
+		": f { a } to ;",
+		": f { a } ; f",
+		": f { a } 1 to a ; f",
+	}
+
+	for _, test := range tests {
+		e := New()
+		err := e.Eval(test)
+		if err == nil {
+			t.Fatalf("expected an error evaluating '%s'", test)
+		}
+	}
+}
+
+func TestLocalsDecompile(t *testing.T) {
+
+	e := New()
+	err := e.Eval(": f { a } a 1 + to a ;")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	codes, err := e.Decompile(e.findWord("f"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var text []string
+	for _, code := range codes {
+		text = append(text, code.Text)
+	}
+	out := strings.Join(text, " ")
+	expected := "[local-store a] [local-fetch a] store 1 + [local-store a]"
+	if out != expected {
+		t.Fatalf("unexpected decompilation '%s'", out)
+	}
+}
@@ -0,0 +1,219 @@
+// This file contains our maps, which associate string keys with values,
+// and are created with `map`:
+//
+//	map ages                    \ an empty map
+//	42 "steve" ages map-put     \ store a value
+//	"steve" ages map-get        \ push 42 1, or 0 0 if it is missing
+//
+// The name of a map pushes a reference to it, which the map words expect
+// to find upon the top of the stack.  Keys are given as strings, and
+// their contents are copied into the map, so the string itself may be
+// reclaimed later.
+
+package eval
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/skx/foth/foth/stack"
+)
+
+// table holds the contents of a single map.
+type table struct {
+	// name holds the name of the map.
+	name string
+
+	// values holds the entries of the map.
+	values map[string]stack.Cell
+}
+
+// GetMap returns the contents of the specified map.
+//
+// This is designed to be used by host-applications which embed
+// this library.
+func (e *Eval) GetMap(name string) (map[string]float64, error) {
+
+	idx := e.findMap(name)
+	if idx < 0 {
+		return nil, fmt.Errorf("map %s not found", name)
+	}
+
+	res := make(map[string]float64, len(e.maps[idx].values))
+	for k, c := range e.maps[idx].values {
+		res[k] = c.Float()
+	}
+	return res, nil
+}
+
+// SetMap replaces the contents of the specified map, defining it if
+// necessary.
+//
+// This is designed to be used by host-applications which embed
+// this library, so Limits.MaxMemory doesn't apply.
+func (e *Eval) SetMap(name string, values map[string]float64) error {
+
+	cells := make(map[string]stack.Cell, len(values))
+	for k, v := range values {
+		cells[k] = stack.FloatCell(v)
+	}
+
+	idx := e.findMap(name)
+	if idx >= 0 {
+		e.maps[idx].values = cells
+		return nil
+	}
+
+	return e.addMap(name, cells)
+}
+
+// addMap defines a new map with the given name, and contents, along
+// with the word which pushes a reference to it.
+func (e *Eval) addMap(name string, values map[string]stack.Cell) error {
+
+	idx := e.findMap(name)
+	if idx != -1 {
+		e.maps[idx].name = ""
+	}
+
+	err := e.addReference(name, stack.MapCell(int64(len(e.maps))))
+	if err != nil {
+		return err
+	}
+
+	e.maps = append(e.maps, table{name: strings.ToLower(name), values: values})
+	return nil
+}
+
+// findMap returns the index of the specified map, or -1 if it cannot be
+// found.
+func (e *Eval) findMap(name string) int {
+	name = strings.ToLower(name)
+	for i, m := range e.maps {
+		if m.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// popMap removes the map reference on the top of the stack, and returns
+// the map it refers to.
+func (e *Eval) popMap() (*table, error) {
+	c, err := e.Stack.PopCell()
+	if err != nil {
+		return nil, err
+	}
+	if c.Kind != stack.Map || c.I < 0 || c.I >= int64(len(e.maps)) {
+		return nil, fmt.Errorf("%s is not a map", c)
+	}
+	return &e.maps[c.I], nil
+}
+
+// defineMap defines an empty map, with the name which follows.
+func (e *Eval) defineMap() error {
+	e.defining = func(name string) error {
+		if e.debug {
+			e.debugf("defining map %s\n", name)
+		}
+		return e.addMap(name, map[string]stack.Cell{})
+	}
+	return nil
+}
+
+// mapCount pushes the number of entries in a map.
+func (e *Eval) mapCount() error {
+	m, err := e.popMap()
+	if err != nil {
+		return err
+	}
+	e.Stack.PushInt(int64(len(m.values)))
+	return nil
+}
+
+// mapDel removes the entry with the given key from a map, if present.
+func (e *Eval) mapDel() error {
+	m, err := e.popMap()
+	if err != nil {
+		return err
+	}
+	key, err := e.popString()
+	if err != nil {
+		return err
+	}
+	delete(m.values, key)
+	return nil
+}
+
+// mapGet pushes the value stored under the given key, followed by 1.  If
+// the key isn't present 0 is pushed twice.
+func (e *Eval) mapGet() error {
+	m, err := e.popMap()
+	if err != nil {
+		return err
+	}
+	key, err := e.popString()
+	if err != nil {
+		return err
+	}
+	value, ok := m.values[key]
+	if !ok {
+		e.Stack.PushInt(0)
+		e.Stack.PushInt(0)
+		return nil
+	}
+	e.Stack.PushCell(value)
+	e.Stack.PushInt(1)
+	return nil
+}
+
+// mapKeys pushes each key of a map, as a string, in sorted order, followed
+// by the number of keys.
+func (e *Eval) mapKeys() error {
+	m, err := e.popMap()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(m.values))
+	for k := range m.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		err = e.pushString(k)
+		if err != nil {
+			return err
+		}
+	}
+	e.Stack.PushInt(int64(len(keys)))
+	return e.checkStack()
+}
+
+// mapPut stores a value under the given key, replacing any existing
+// entry.
+func (e *Eval) mapPut() error {
+	m, err := e.popMap()
+	if err != nil {
+		return err
+	}
+	key, err := e.popString()
+	if err != nil {
+		return err
+	}
+	value, err := e.Stack.PopCell()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := m.values[key]; !ok {
+		err = e.checkMemory(1)
+		if err != nil {
+			return err
+		}
+	}
+	m.values[key] = value
+	return nil
+}
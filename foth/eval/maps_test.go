@@ -0,0 +1,148 @@
+package eval
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMaps(t *testing.T) {
+
+	type TestCase struct {
+		input  string
+		output string
+	}
+
+	tests := []TestCase{
+		{"map m m map-count .", "0 "},
+		{"map m 42 \"a\" m map-put \"a\" m map-get . .", "1 42 "},
+		{"map m \"a\" m map-get . .", "0 0 "},
+		{"map m 1.5 \"a\" m map-put \"a\" m map-get drop .", "1.5 "},
+		{"map m 1 \"a\" m map-put 2 \"a\" m map-put m map-count . \"a\" m map-get drop .", "1 2 "},
+		{"map M 7 \"a\" m map-put \"a\" M map-get drop .", "7 "},
+
+		// keys are compared by contents
+		{"map m 3 \"k\" m map-put \"k\" \"\" s+ m map-get drop .", "3 "},
+
+		// deleting entries
+		{"map m 1 \"a\" m map-put \"a\" m map-del m map-count . \"a\" m map-get . .", "0 0 0 "},
+		{"map m \"missing\" m map-del m map-count .", "0 "},
+
+		// keys are pushed in order, followed by their count
+		{"map m 1 \"b\" m map-put 2 \"a\" m map-put m map-keys . strprn strprn", "2 ba"},
+		{"map m m map-keys .", "0 "},
+
+		// maps may be used within words, and held in variables
+		{"map m : inc dup m map-get 0= if drop 0 then 1 + swap m map-put ; \"x\" inc \"x\" inc \"x\" m map-get drop .", "2 "},
+		{"map m variable v m v ! 5 \"a\" v @ map-put \"a\" m map-get drop .", "5 "},
+		{"map a map b a b = . a a = .", "0 1 "},
+
+		// strings held in maps are kept alive
+		{"map m \"kept\" \"k\" m map-put 100 0 do \"x\" \"y\" s+ drop loop \"k\" m map-get drop strprn", "kept"},
+
+		// redefining a map replaces it
+		{"map m 1 \"a\" m map-put map m m map-count .", "0 "},
+	}
+
+	for _, test := range tests {
+
+		e := New()
+		out := e.CaptureOutput()
+
+		err := e.Eval(test.input)
+		if err != nil {
+			t.Fatalf("unexpected error evaluating '%s': %s", test.input, err.Error())
+		}
+		if out.String() != test.output {
+			t.Fatalf("'%s' gave '%s', not '%s'", test.input, out.String(), test.output)
+		}
+		if !e.Stack.IsEmpty() {
+			t.Fatalf("'%s' left items on the stack", test.input)
+		}
+	}
+}
+
+func TestMapErrors(t *testing.T) {
+
+	tests := []string{
+		"map-count",
+		"3 map-count",
+		"3 array a a map-count",
+		"map m 1 m map-put",
+		"map m 1 1000 m map-put",
+		"map m \"a\" m map-put",
+		"map m 1000 m map-get",
+		"map m m map-get",
+		"map m m map-del",
+		"map-keys",
+		"map m m 1 +",
+		"map m 0 m a@",
+	}
+
+	for _, test := range tests {
+		e := New()
+		err := e.Eval(test)
+		if err == nil {
+			t.Fatalf("expected an error evaluating '%s'", test)
+		}
+	}
+}
+
+func TestMapLimit(t *testing.T) {
+
+	e := New()
+
+	// The base variable uses one cell
+	e.SetLimits(Limits{MaxMemory: 3})
+
+	err := e.Eval("map m 1 \"a\" m map-put 2 \"b\" m map-put 3 \"a\" m map-put")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	err = e.Eval("4 \"c\" m map-put")
+	if !errors.Is(err, ErrMemoryLimit) {
+		t.Fatalf("expected memory limit, got %v", err)
+	}
+}
+
+func TestGetSetMap(t *testing.T) {
+
+	e := New()
+
+	_, err := e.GetMap("ages")
+	if err == nil {
+		t.Fatalf("expected an error for a missing map")
+	}
+
+	err = e.SetMap("ages", map[string]float64{"steve": 42, "bob": 7})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	err = e.Eval("\"bob\" ages map-del 1.5 \"alice\" ages map-put")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	out, err := e.GetMap("ages")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(out) != 2 || out["steve"] != 42 || out["alice"] != 1.5 {
+		t.Fatalf("wrong result %v", out)
+	}
+
+	// Replacing a map keeps the same reference
+	err = e.SetMap("ages", map[string]float64{"x": 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	err = e.Eval("ages map-count")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	n, _ := e.Stack.Pop()
+	if n != 1 {
+		t.Fatalf("wrong result %f", n)
+	}
+}
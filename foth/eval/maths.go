@@ -0,0 +1,205 @@
+// This file contains the mathematical word set, which is largely a thin
+// wrapper around the functions in golang's math package.
+//
+// These words operate upon the stack, and return floating-point results,
+// except where noted.
+
+package eval
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/skx/foth/foth/stack"
+)
+
+// constants holds the names of our built-in constants, which are hidden
+// by a variable of the same name.  See resolveWord.
+var constants = map[string]bool{"e": true, "pi": true}
+
+// popNumber removes the number on the top of the stack, and returns
+// it, failing if it is a reference to an array or map.
+func (e *Eval) popNumber() (stack.Cell, error) {
+	a, err := e.Stack.PopCell()
+	if err != nil {
+		return a, err
+	}
+	if a.IsReference() {
+		return a, fmt.Errorf("%s is not a number", a)
+	}
+	return a, nil
+}
+
+// mathOp returns a function which pops a number from the stack, and
+// pushes the result of calling the given function upon it.
+func (e *Eval) mathOp(op func(float64) float64) func() error {
+	return func() error {
+		a, err := e.popNumber()
+		if err != nil {
+			return err
+		}
+		e.Stack.Push(op(a.Float()))
+		return nil
+	}
+}
+
+// mathBinOp returns a function which pops two numbers from the stack,
+// and pushes the result of calling the given function upon them.
+//
+// Unlike binOp the arguments are given in the order they were pushed.
+func (e *Eval) mathBinOp(op func(float64, float64) float64) func() error {
+	return func() error {
+		b, err := e.popNumber()
+		if err != nil {
+			return err
+		}
+		a, err := e.popNumber()
+		if err != nil {
+			return err
+		}
+		e.Stack.Push(op(a.Float(), b.Float()))
+		return nil
+	}
+}
+
+// roundOp is like mathOp, except integers are left unchanged.
+func (e *Eval) roundOp(op func(float64) float64) func() error {
+	return func() error {
+		a, err := e.popNumber()
+		if err != nil {
+			return err
+		}
+		if a.IsInteger() {
+			e.Stack.PushCell(a)
+			return nil
+		}
+		e.Stack.Push(op(a.Float()))
+		return nil
+	}
+}
+
+// mathTest returns a function which pops a number from the stack, and
+// pushes 1 if the given function returns true for it, and 0 otherwise.
+func (e *Eval) mathTest(test func(float64) bool) func() error {
+	return func() error {
+		a, err := e.popNumber()
+		if err != nil {
+			return err
+		}
+		if test(a.Float()) {
+			e.Stack.PushInt(1)
+		} else {
+			e.Stack.PushInt(0)
+		}
+		return nil
+	}
+}
+
+// abs returns the absolute value of a number, which retains its type.
+func (e *Eval) abs() error {
+	a, err := e.popNumber()
+	if err != nil {
+		return err
+	}
+	switch a.Kind {
+	case stack.Int:
+		if a.I == math.MinInt64 {
+			a = stack.BigIntCell(new(big.Int).Neg(a.Big()))
+		} else if a.I < 0 {
+			a.I = -a.I
+		}
+	case stack.BigInt:
+		a.B = new(big.Int).Abs(a.B)
+	case stack.BigRat:
+		a.R = new(big.Rat).Abs(a.R)
+	default:
+		a.F = math.Abs(a.F)
+	}
+	e.Stack.PushCell(a)
+	return nil
+}
+
+func (e *Eval) atan2() error {
+	return e.mathBinOp(math.Atan2)()
+}
+
+func (e *Eval) ceil() error {
+	return e.roundOp(math.Ceil)()
+}
+
+func (e *Eval) cos() error {
+	return e.mathOp(math.Cos)()
+}
+
+func (e *Eval) exp() error {
+	return e.mathOp(math.Exp)()
+}
+
+func (e *Eval) floor() error {
+	return e.roundOp(math.Floor)()
+}
+
+func (e *Eval) fmod() error {
+	return e.mathBinOp(math.Mod)()
+}
+
+func (e *Eval) hypot() error {
+	return e.mathBinOp(math.Hypot)()
+}
+
+// infp tests whether a number is infinite, either positive or negative.
+func (e *Eval) infp() error {
+	return e.mathTest(func(n float64) bool { return math.IsInf(n, 0) })()
+}
+
+func (e *Eval) ln() error {
+	return e.mathOp(math.Log)()
+}
+
+func (e *Eval) log10() error {
+	return e.mathOp(math.Log10)()
+}
+
+// nanp tests whether a number is not-a-number.
+func (e *Eval) nanp() error {
+	return e.mathTest(math.IsNaN)()
+}
+
+// pushE pushes Euler's number.
+func (e *Eval) pushE() error {
+	e.Stack.Push(math.E)
+	return nil
+}
+
+// pushPi pushes pi.
+func (e *Eval) pushPi() error {
+	e.Stack.Push(math.Pi)
+	return nil
+}
+
+func (e *Eval) pow() error {
+	return e.mathBinOp(math.Pow)()
+}
+
+// round rounds a number to the nearest integer, with halves rounded
+// away from zero.
+func (e *Eval) round() error {
+	return e.roundOp(math.Round)()
+}
+
+func (e *Eval) sin() error {
+	return e.mathOp(math.Sin)()
+}
+
+func (e *Eval) sqrt() error {
+	return e.mathOp(math.Sqrt)()
+}
+
+func (e *Eval) tan() error {
+	return e.mathOp(math.Tan)()
+}
+
+func (e *Eval) trunc() error {
+	return e.roundOp(math.Trunc)()
+}
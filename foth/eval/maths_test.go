@@ -0,0 +1,131 @@
+package eval
+
+import (
+	"math"
+	"testing"
+
+	"github.com/skx/foth/foth/stack"
+)
+
+func TestMaths(t *testing.T) {
+
+	type TestCase struct {
+		input  string
+		result stack.Cell
+	}
+
+	tests := []TestCase{
+		{"-3 abs", stack.IntCell(3)},
+		{"3 abs", stack.IntCell(3)},
+		{"-2.5 abs", stack.FloatCell(2.5)},
+		{"16 sqrt", stack.FloatCell(4)},
+		{"2 10 pow", stack.FloatCell(1024)},
+		{"2 0.5 **", stack.FloatCell(math.Sqrt2)},
+		{"0 exp", stack.FloatCell(1)},
+		{"e ln", stack.FloatCell(1)},
+		{"1000 log10", stack.FloatCell(3)},
+		{"0 sin", stack.FloatCell(0)},
+		{"0 cos", stack.FloatCell(1)},
+		{"0 tan", stack.FloatCell(0)},
+		{"1 1 atan2", stack.FloatCell(math.Pi / 4)},
+		{"2.5 floor", stack.FloatCell(2)},
+		{"-2.5 floor", stack.FloatCell(-3)},
+		{"2.1 ceil", stack.FloatCell(3)},
+		{"2.5 round", stack.FloatCell(3)},
+		{"-2.5 round", stack.FloatCell(-3)},
+		{"-2.7 trunc", stack.FloatCell(-2)},
+		{"7 floor", stack.IntCell(7)},
+		{"7 ceil", stack.IntCell(7)},
+		{"7 round", stack.IntCell(7)},
+		{"7 trunc", stack.IntCell(7)},
+		{"5.5 2 fmod", stack.FloatCell(1.5)},
+		{"3 4 hypot", stack.FloatCell(5)},
+		{"pi", stack.FloatCell(math.Pi)},
+		{"e", stack.FloatCell(math.E)},
+		{"-1 sqrt nan?", stack.IntCell(1)},
+		{"4 sqrt nan?", stack.IntCell(0)},
+		{"0 ln inf?", stack.IntCell(1)},
+		{"1 ln inf?", stack.IntCell(0)},
+
+		// user variables replace the constants
+		{"variable e 5 e ! e @", stack.IntCell(5)},
+		{"variable PI 3.14 PI ! PI @", stack.FloatCell(3.14)},
+		{"fvariable pi pi", stack.IntCell(1)},
+		{"variable PI 3 PI ! pi", stack.FloatCell(math.Pi)},
+		{": f e ; variable e f", stack.FloatCell(math.E)},
+	}
+
+	for _, test := range tests {
+
+		e := New()
+		err := e.Eval(test.input)
+		if err != nil {
+			t.Fatalf("unexpected error evaluating '%s': %s", test.input, err.Error())
+		}
+
+		out, err := e.Stack.PopCell()
+		if err != nil {
+			t.Fatalf("failed to get stack value for '%s'", test.input)
+		}
+		if out.Kind != test.result.Kind || math.Abs(out.Float()-test.result.Float()) > 1e-12 {
+			t.Fatalf("'%s' gave %v, not %v", test.input, out, test.result)
+		}
+		if !e.Stack.IsEmpty() {
+			t.Fatalf("'%s' left items on the stack", test.input)
+		}
+	}
+}
+
+func TestVariablesKeepWords(t *testing.T) {
+
+	type TestCase struct {
+		input  string
+		output string
+	}
+
+	tests := []TestCase{
+		{"variable i : t 3 0 do i . loop ; t", "0 1 2 "},
+		{"variable dup 3 dup * .", "9 "},
+		{"variable e 5 e ! e @ .", "5 "},
+	}
+
+	for _, test := range tests {
+
+		e := New()
+		out := e.CaptureOutput()
+
+		err := e.Eval(test.input)
+		if err != nil {
+			t.Fatalf("unexpected error evaluating '%s': %s", test.input, err.Error())
+		}
+		if out.String() != test.output {
+			t.Fatalf("'%s' gave '%s', not '%s'", test.input, out.String(), test.output)
+		}
+	}
+}
+
+func TestMathsErrors(t *testing.T) {
+
+	tests := []string{
+		"abs",
+		"sqrt",
+		"floor",
+		"nan?",
+		"pow",
+		"2 pow",
+		"2 atan2",
+		"3 array a a sqrt",
+		"map m m abs",
+		"map m 2 m pow",
+		"3 array a a floor",
+		"map m m nan?",
+	}
+
+	for _, test := range tests {
+		e := New()
+		err := e.Eval(test)
+		if err == nil {
+			t.Fatalf("expected an error evaluating '%s'", test)
+		}
+	}
+}
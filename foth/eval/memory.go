@@ -0,0 +1,268 @@
+// This file contains our data space, which is a linear memory of cells
+// addressed from zero.
+//
+// Variables are allocated within it, so `x` pushes the address of the
+// variable x, and `@` and `!` work upon any address:
+//
+//	here 3 allot          \ reserve three cells
+//	42 here 1 - !         \ store into the last of them
+//
+// Memory is addressed in cells, and a character occupies a whole cell,
+// so `cells` leaves its argument unchanged, and `cell+` adds one.
+
+package eval
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/skx/foth/foth/stack"
+)
+
+// maxMemoryBytes is the most space, in bytes, the cells held by our
+// memory, arrays, and maps may occupy, even if Limits.MaxMemory isn't set.
+const maxMemoryBytes = 64 << 20
+
+// maxCells is the most cells our memory, arrays, and maps may hold in
+// total.  Each cell occupies 40 bytes on 64-bit systems, so this is a
+// little over 1.6 million cells.
+const maxCells = maxMemoryBytes / int64(unsafe.Sizeof(stack.Cell{}))
+
+// allocate appends the given cells to our memory, returning the address
+// of the first of them.
+func (e *Eval) allocate(cells ...stack.Cell) (int, error) {
+	err := e.checkMemory(int64(len(cells)))
+	if err != nil {
+		return 0, err
+	}
+	addr := len(e.memory)
+	e.memory = append(e.memory, cells...)
+	return addr, nil
+}
+
+// addVariable allocates a cell holding the given value, and defines a
+// variable with the given name to refer to it.
+func (e *Eval) addVariable(name string, value stack.Cell) error {
+	addr, err := e.allocate(value)
+	if err != nil {
+		return err
+	}
+	e.vars = append(e.vars, Variable{Name: name, Addr: addr})
+	return nil
+}
+
+// checkRange ensures that the given number of cells, starting at the
+// given address, are all within our memory.
+func (e *Eval) checkRange(addr int64, count int64) error {
+	if count < 0 {
+		return fmt.Errorf("invalid count %d", count)
+	}
+	if addr < 0 || addr > int64(len(e.memory)) || count > int64(len(e.memory))-addr {
+		return fmt.Errorf("invalid address %d", addr)
+	}
+	return nil
+}
+
+// popAddr removes the address on the top of the stack, and returns it,
+// ensuring that it is within our memory.
+func (e *Eval) popAddr() (int, error) {
+	addr, err := e.popInt()
+	if err != nil {
+		return 0, err
+	}
+	err = e.checkRange(addr, 1)
+	if err != nil {
+		return 0, err
+	}
+	return int(addr), nil
+}
+
+// store writes a value to the given address, which must be valid.
+func (e *Eval) store(addr int, value stack.Cell) {
+	e.memory[addr] = value
+
+	if e.tracer != nil {
+		for _, v := range e.vars {
+			if v.Addr == addr {
+				e.trace(TraceEvent{Kind: TraceVariable, Variable: v.Name, Value: value})
+			}
+		}
+	}
+}
+
+// allot reserves the given number of cells, which are zeroed.
+func (e *Eval) allot() error {
+	n, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return fmt.Errorf("allot: cannot release memory")
+	}
+	err = e.checkMemory(n)
+	if err != nil {
+		return fmt.Errorf("allot: %w", err)
+	}
+	_, err = e.allocate(zeros(n)...)
+	return err
+}
+
+// cComma appends a character to our memory.
+func (e *Eval) cComma() error {
+	c, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	_, err = e.allocate(stack.IntCell(c & 0xff))
+	return err
+}
+
+// cFetch pushes the character at the given address.
+func (e *Eval) cFetch() error {
+	addr, err := e.popAddr()
+	if err != nil {
+		return err
+	}
+	c, err := toInt(e.memory[addr])
+	if err != nil {
+		return err
+	}
+	e.Stack.PushInt(c & 0xff)
+	return nil
+}
+
+// cStore stores a character at the given address.
+func (e *Eval) cStore() error {
+	addr, err := e.popAddr()
+	if err != nil {
+		return err
+	}
+	c, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	e.store(addr, stack.IntCell(c&0xff))
+	return nil
+}
+
+// cellPlus adds the size of a cell to an address.
+func (e *Eval) cellPlus() error {
+	addr, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	e.Stack.PushInt(addr + 1)
+	return nil
+}
+
+// cells converts a number of cells to a number of address units, which
+// are the same thing.
+func (e *Eval) cells() error {
+	n, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	e.Stack.PushInt(n)
+	return nil
+}
+
+// comma appends a value to our memory.
+func (e *Eval) comma() error {
+	value, err := e.Stack.PopCell()
+	if err != nil {
+		return err
+	}
+	_, err = e.allocate(value)
+	return err
+}
+
+// fill stores a value into each of a number of cells.
+//
+// If an array is on the top of the stack then each of its entries is
+// set instead.
+func (e *Eval) fill() error {
+	if !e.Stack.IsEmpty() && e.Stack.AtCell(e.Stack.Len()-1).Kind == stack.Array {
+		return e.fillArray()
+	}
+
+	value, err := e.Stack.PopCell()
+	if err != nil {
+		return err
+	}
+	count, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	addr, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	err = e.checkRange(addr, count)
+	if err != nil {
+		return err
+	}
+	for i := addr; i < addr+count; i++ {
+		e.store(int(i), value)
+	}
+	return nil
+}
+
+// here pushes the address of the next free cell.
+func (e *Eval) here() error {
+	e.Stack.PushInt(int64(len(e.memory)))
+	return nil
+}
+
+// move copies a number of cells from one address to another.  The areas
+// may overlap.
+func (e *Eval) move() error {
+	count, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	dst, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	src, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	err = e.checkRange(src, count)
+	if err != nil {
+		return err
+	}
+	err = e.checkRange(dst, count)
+	if err != nil {
+		return err
+	}
+	copy(e.memory[dst:dst+count], e.memory[src:src+count])
+	return nil
+}
+
+// plusStore adds a number to the value at the given address.
+func (e *Eval) plusStore() error {
+	addr, err := e.popAddr()
+	if err != nil {
+		return err
+	}
+	n, err := e.Stack.PopCell()
+	if err != nil {
+		return err
+	}
+
+	// Use `+`, so that the usual rules for mixing integers and
+	// floating-point numbers apply.
+	e.Stack.PushCell(e.memory[addr])
+	e.Stack.PushCell(n)
+	err = e.add()
+	if err != nil {
+		return err
+	}
+	sum, err := e.Stack.PopCell()
+	if err != nil {
+		return err
+	}
+	e.store(addr, sum)
+	return nil
+}
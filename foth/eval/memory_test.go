@@ -0,0 +1,167 @@
+package eval
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/skx/foth/foth/stack"
+)
+
+func TestMemory(t *testing.T) {
+
+	type TestCase struct {
+		input  string
+		output string
+	}
+
+	tests := []TestCase{
+		// variables live in memory
+		{"variable x 3 x ! x @ .", "3 "},
+		{"variable x here x - .", "1 "},
+		{"variable x variable y y x - .", "1 "},
+
+		// allocating memory
+		{"here 3 allot here swap - .", "3 "},
+		{"here 0 allot here = .", "1 "},
+		{"here 5 allot @ .", "0 "},
+		{"here 42 , 43 , dup @ . cell+ @ .", "42 43 "},
+		{"here 1.5 , @ .", "1.5 "},
+		{"3 cells .", "3 "},
+		{"7 cell+ .", "8 "},
+
+		// any address may be read and written
+		{"here 2 allot 9 over cell+ ! cell+ @ .", "9 "},
+		{"variable x 10 x ! 5 x +! x @ .", "15 "},
+		{"variable x 10 x ! 0.5 x +! x @ .", "10.5 "},
+
+		// characters
+		{"here 'A' c, c@ emit", "A"},
+		{"here 300 c, c@ .", "44 "},
+		{"variable x 'z' x c! x c@ emit", "z"},
+
+		// fill and move
+		{"here 3 allot dup 3 7 fill dup @ . dup cell+ @ . 2 + @ .", "7 7 7 "},
+		{"here 1 , 2 , 3 , here 3 allot over over 3 move swap drop dup @ . 2 + @ .", "1 3 "},
+		{"here 1 , 2 , 3 , dup dup cell+ 2 move dup @ . dup cell+ @ . 2 + @ .", "1 1 2 "},
+		{"here 0 0 fill here here 0 move", ""},
+
+		// floating-point words use memory too
+		{"fvariable f 2.5 >f f f! f @ .", "2.5 "},
+		{"here 1 allot 0.25 >f dup f! f@ f.", "0.25 "},
+
+		// strings in memory are kept alive
+		{"here \"kept\" , 100 0 do \"x\" \"y\" s+ drop loop @ strprn", "kept"},
+	}
+
+	for _, test := range tests {
+
+		e := New()
+		out := e.CaptureOutput()
+
+		err := e.Eval(test.input)
+		if err != nil {
+			t.Fatalf("unexpected error evaluating '%s': %s", test.input, err.Error())
+		}
+		if out.String() != test.output {
+			t.Fatalf("'%s' gave '%s', not '%s'", test.input, out.String(), test.output)
+		}
+		if !e.Stack.IsEmpty() {
+			t.Fatalf("'%s' left items on the stack", test.input)
+		}
+	}
+}
+
+func TestMemoryErrors(t *testing.T) {
+
+	tests := []string{
+		"@",
+		"100 @",
+		"-1 @",
+		"1.5 @",
+		"here @",
+		"3 100 !",
+		"3 -1 !",
+		"100 c@",
+		"3 100 c!",
+		"1 100 +!",
+		"-1 allot",
+		"1.5 allot",
+		"1000000000000000000 allot",
+		"1 allot 16777215 allot",
+		"allot",
+		",",
+		"c,",
+		"0 5 1 fill",
+		"-1 1 1 fill",
+		"0 -1 1 fill",
+		"0 0 5 move",
+		"0 100 1 move",
+		"100 f@",
+		"1 >f 100 f!",
+		"1.5 cells",
+		"1.5 cell+",
+	}
+
+	for _, test := range tests {
+		e := New()
+		err := e.Eval(test)
+		if err == nil {
+			t.Fatalf("expected an error evaluating '%s'", test)
+		}
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+
+	tests := []string{
+		"10 allot",
+		"1000000000000 allot",
+		"1 , 2 , 3 , 4 ,",
+		"variable a variable b variable c variable d",
+		"fvariable a fvariable b fvariable c fvariable d",
+	}
+
+	for _, test := range tests {
+		e := New()
+		e.SetLimits(Limits{MaxMemory: 4})
+
+		err := e.Eval(test)
+		if !errors.Is(err, ErrMemoryLimit) {
+			t.Fatalf("%s: expected memory limit, got %v", test, err)
+		}
+	}
+
+	// The limit isn't reached by less
+	e := New()
+	e.SetLimits(Limits{MaxMemory: 4})
+	err := e.Eval("1 , 2 allot")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestMemoryTrace(t *testing.T) {
+
+	e := New()
+
+	var seen []string
+	e.SetTracer(func(ev TraceEvent) {
+		if ev.Kind == TraceVariable {
+			seen = append(seen, ev.Variable)
+		}
+	})
+
+	// Only writes to variables are traced
+	err := e.Eval("variable x 1 x ! 2 x +! 3 , 4 here 1 - !")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(seen) != 2 || seen[0] != "x" || seen[1] != "x" {
+		t.Fatalf("unexpected trace: %v", seen)
+	}
+
+	vars := e.Variables()
+	if len(vars) != 2 || vars[1].Value != stack.IntCell(3) {
+		t.Fatalf("unexpected variables: %v", vars)
+	}
+}
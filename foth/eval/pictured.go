@@ -0,0 +1,203 @@
+// This file contains the words for pictured numeric output, which
+// allow numbers to be formatted a digit at a time, along with those
+// which print numbers right-aligned, or unsigned.
+//
+// For example this shows a number with at least four digits:
+//
+//	<# # # # #s #> strprn
+
+package eval
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/skx/foth/foth/stack"
+)
+
+// digits holds the characters used to show each digit, for all of the
+// number-bases we support.
+const digits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// popInt removes the number on the top of the stack, which must be
+// an integer.
+func (e *Eval) popInt() (int64, error) {
+	c, err := e.Stack.PopCell()
+	if err != nil {
+		return 0, err
+	}
+	return toInt(c)
+}
+
+// checkPicturing ensures we're between `<#` and `#>`.
+func (e *Eval) checkPicturing(name string) error {
+	if !e.picturing {
+		return fmt.Errorf("'%s' used outside '<#' and '#>'", name)
+	}
+	return nil
+}
+
+// picturedStart begins pictured numeric output.
+func (e *Eval) picturedStart() error {
+	e.pictured = nil
+	e.picturing = true
+	return nil
+}
+
+// picturedDigit divides the number on the top of the stack by the current
+// number-base, and adds the remainder to the start of the output.
+//
+// As with standard FORTH the number is treated as unsigned, so negative
+// numbers should use `abs` and `sign`.
+func (e *Eval) picturedDigit() error {
+	err := e.checkPicturing("#")
+	if err != nil {
+		return err
+	}
+	n, err := e.popInt()
+	if err != nil {
+		return err
+	}
+
+	u := uint64(n)
+	base := uint64(e.numberBase())
+	e.pictured = append([]rune{rune(digits[u%base])}, e.pictured...)
+	e.Stack.PushInt(int64(u / base))
+	return nil
+}
+
+// picturedDigits adds digits until the number on the top of the stack is
+// zero, which always adds at least one digit.
+func (e *Eval) picturedDigits() error {
+	for {
+		err := e.picturedDigit()
+		if err != nil {
+			return err
+		}
+		if e.Stack.AtCell(e.Stack.Len()-1).I == 0 {
+			return nil
+		}
+	}
+}
+
+// hold adds the given character to the start of the output.
+func (e *Eval) hold() error {
+	err := e.checkPicturing("hold")
+	if err != nil {
+		return err
+	}
+	c, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	e.pictured = append([]rune{rune(c)}, e.pictured...)
+	return nil
+}
+
+// sign adds a "-" to the start of the output, if the number on the top
+// of the stack is negative.
+func (e *Eval) sign() error {
+	err := e.checkPicturing("sign")
+	if err != nil {
+		return err
+	}
+	n, err := e.Stack.PopCell()
+	if err != nil {
+		return err
+	}
+	if stack.Compare(n, stack.IntCell(0)) < 0 {
+		e.pictured = append([]rune{'-'}, e.pictured...)
+	}
+	return nil
+}
+
+// picturedEnd completes pictured numeric output, dropping the number on
+// the top of the stack and replacing it with the string we've built.
+func (e *Eval) picturedEnd() error {
+	err := e.checkPicturing("#>")
+	if err != nil {
+		return err
+	}
+	_, err = e.Stack.Pop()
+	if err != nil {
+		return err
+	}
+
+	str := string(e.pictured)
+	e.pictured = nil
+	e.picturing = false
+	return e.pushString(str)
+}
+
+// maxWidth is the widest field `.r`, and `u.r`, may pad to, which is the
+// same limit golang's fmt package applies.
+const maxWidth = 1000000
+
+// popWidth removes the field-width on the top of the stack, and returns
+// it, ensuring that it isn't too large.
+func (e *Eval) popWidth() (int64, error) {
+	width, err := e.popInt()
+	if err != nil {
+		return 0, err
+	}
+	if width > maxWidth {
+		return 0, fmt.Errorf("field width %d is too large, the maximum is %d", width, maxWidth)
+	}
+	return width, nil
+}
+
+// padLeft pads the given string with spaces, to the given width.
+func padLeft(str string, width int64) string {
+	pad := width - int64(utf8.RuneCountInString(str))
+	if pad <= 0 {
+		return str
+	}
+	return strings.Repeat(" ", int(pad)) + str
+}
+
+// dotR outputs a number right-aligned in a field of the given width.
+func (e *Eval) dotR() error {
+	width, err := e.popWidth()
+	if err != nil {
+		return err
+	}
+	n, err := e.Stack.PopCell()
+	if err != nil {
+		return err
+	}
+	e.printString(padLeft(e.formatNumber(n), width))
+	return nil
+}
+
+// formatUnsigned returns the given integer formatted as an unsigned number.
+func (e *Eval) formatUnsigned(n int64) string {
+	return strings.ToUpper(strconv.FormatUint(uint64(n), e.numberBase()))
+}
+
+// udot outputs an integer as an unsigned number, followed by a space.
+func (e *Eval) udot() error {
+	n, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	e.printString(e.formatUnsigned(n))
+	e.dotSeparator()
+	return nil
+}
+
+// udotR outputs an integer as an unsigned number, right-aligned in a
+// field of the given width.
+func (e *Eval) udotR() error {
+	width, err := e.popWidth()
+	if err != nil {
+		return err
+	}
+	n, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	e.printString(padLeft(e.formatUnsigned(n), width))
+	return nil
+}
@@ -0,0 +1,119 @@
+package eval
+
+import (
+	"testing"
+)
+
+func TestPictured(t *testing.T) {
+
+	type TestCase struct {
+		input  string
+		output string
+	}
+
+	tests := []TestCase{
+		{"123 <# #s #> strprn", "123"},
+		{"0 <# #s #> strprn", "0"},
+		{"7 <# # # # #s #> strprn", "0007"},
+		{"-42 dup abs <# #s swap sign #> strprn", "-42"},
+		{"42 dup abs <# #s swap sign #> strprn", "42"},
+		{"1234 <# # # '.' hold #s '$' hold #> strprn", "$12.34"},
+		{"255 hex <# #s #> decimal strprn", "FF"},
+		{"5 binary <# # # # # #> decimal strprn", "0101"},
+		{"-1 <# # #> strprn", "5"},
+		{"42 5 .r", "   42"},
+		{"-42 5 .r", "  -42"},
+		{"123456 3 .r", "123456"},
+		{"2.5 5 .r", "  2.5"},
+		{"255 hex 4 .r decimal", "  FF"},
+		{"42 u.", "42 "},
+		{"-1 u.", "18446744073709551615 "},
+		{"-1 hex u. decimal", "FFFFFFFFFFFFFFFF "},
+		{"42 6 u.r", "    42"},
+		{"1 2 3 . . .", "3 2 1 "},
+		{"3 print", "3\n"},
+	}
+
+	for _, test := range tests {
+
+		e := New()
+		out := e.CaptureOutput()
+
+		err := e.Eval(test.input)
+		if err != nil {
+			t.Fatalf("unexpected error evaluating '%s': %s", test.input, err.Error())
+		}
+		if out.String() != test.output {
+			t.Fatalf("'%s' gave '%s', not '%s'", test.input, out.String(), test.output)
+		}
+		if !e.Stack.IsEmpty() {
+			t.Fatalf("'%s' left items on the stack", test.input)
+		}
+	}
+}
+
+func TestPicturedErrors(t *testing.T) {
+
+	tests := []string{
+		"1 #",
+		"1 #s",
+		"1 #>",
+		"42 hold",
+		"1 sign",
+		"<# #",
+		"<# #s",
+		"<# 1.5 #",
+		"<# hold",
+		"<# sign",
+		"<# #>",
+		"1 .r",
+		"1 1.5 .r",
+		"u.",
+		"1.5 u.",
+		"1 u.r",
+		"1 9223372036854775807 .r",
+		"1 100000000000 .r",
+		"1 1000001 u.r",
+	}
+
+	for _, test := range tests {
+		e := New()
+		err := e.Eval(test)
+		if err == nil {
+			t.Fatalf("expected an error evaluating '%s'", test)
+		}
+	}
+
+	// Errors reset the pictured output
+	e := New()
+	e.Eval("<# 1.5 #")
+	e.Reset()
+	if e.picturing || len(e.pictured) != 0 {
+		t.Fatalf("reset didn't clear the pictured output")
+	}
+}
+
+func TestDotNewline(t *testing.T) {
+
+	e := New()
+	out := e.CaptureOutput()
+
+	e.SetDotNewline(true)
+	err := e.Eval("1 2 . . 3 >f f. 4 u.")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if out.String() != "2\n1\n3\n4\n" {
+		t.Fatalf("unexpected output: '%s'", out.String())
+	}
+
+	out.Reset()
+	e.SetDotNewline(false)
+	err = e.Eval("1 2 . .")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if out.String() != "2 1 " {
+		t.Fatalf("unexpected output: '%s'", out.String())
+	}
+}
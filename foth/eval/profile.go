@@ -0,0 +1,396 @@
+// This file contains our profiler, which records how many times each
+// word is called, and how long was spent within it.
+//
+// The results may be shown as a simple report, via `.profile`, or
+// exported in the format used by `go tool pprof`.
+
+package eval
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ProfileEntry holds the profiling results for a single word.
+type ProfileEntry struct {
+	// Name is the name of the word.
+	Name string
+
+	// Calls is the number of times the word was called.
+	Calls int
+
+	// Inclusive is the total time spent within the word, including
+	// the time spent in the words it called.
+	Inclusive time.Duration
+
+	// Exclusive is the time spent within the word itself, excluding
+	// the time spent in the words it called.
+	Exclusive time.Duration
+}
+
+// profileFrame records a word which is currently executing.
+type profileFrame struct {
+	// index is the dictionary-index of the word.
+	index int
+
+	// start is the time at which the word was entered.
+	start time.Time
+
+	// children is the time spent in the words this word called.
+	children time.Duration
+
+	// overhead is the profiler's total overhead when the word was
+	// entered.
+	overhead time.Duration
+
+	// sample is the call-stack which ends with this word.
+	sample *profileSample
+}
+
+// profileSample records the time spent beneath a unique call-stack,
+// which is what pprof expects to receive.
+type profileSample struct {
+	// stack holds dictionary-indexes, outermost first.
+	stack []int
+
+	// calls is the number of times the innermost word was called.
+	calls int
+
+	// exclusive is the time spent in the innermost word.
+	exclusive time.Duration
+
+	// key identifies the call-stack, within profiler.samples.
+	key string
+
+	// children holds the call-stacks which extend this one, by the
+	// dictionary-index of the word which was called.
+	children map[int]*profileSample
+}
+
+// child returns the call-stack which extends this one with the given
+// word, creating it if necessary.
+func (s *profileSample) child(index int, samples map[string]*profileSample) *profileSample {
+	c, ok := s.children[index]
+	if ok {
+		return c
+	}
+
+	key := strconv.Itoa(index)
+	if s.key != "" {
+		key = s.key + "," + key
+	}
+	stack := make([]int, len(s.stack), len(s.stack)+1)
+	copy(stack, s.stack)
+
+	c = &profileSample{
+		stack:    append(stack, index),
+		key:      key,
+		children: make(map[int]*profileSample),
+	}
+	s.children[index] = c
+	samples[key] = c
+	return c
+}
+
+// profiler holds the state of a profiling run.
+type profiler struct {
+	// started is the time at which profiling began.
+	started time.Time
+
+	// entries holds the results for each word, by dictionary-index.
+	entries map[int]*ProfileEntry
+
+	// samples holds the results for each call-stack.
+	samples map[string]*profileSample
+
+	// root is the empty call-stack, which all others extend.
+	root *profileSample
+
+	// overhead is the time we've spent on our own bookkeeping, which
+	// isn't charged to the words being profiled.
+	overhead time.Duration
+
+	// frames holds the words which are currently executing.
+	frames []profileFrame
+
+	// active counts the frames for each word, so that recursive
+	// calls don't count their inclusive time more than once.
+	active map[int]int
+}
+
+// newProfiler creates a new, empty, profiler.
+func newProfiler() *profiler {
+	return &profiler{
+		started: time.Now(),
+		entries: make(map[int]*ProfileEntry),
+		samples: make(map[string]*profileSample),
+		root:    &profileSample{children: make(map[int]*profileSample)},
+		active:  make(map[int]int),
+	}
+}
+
+// enter is called when the word with the given index, and name, begins
+// executing.
+func (p *profiler) enter(index int, name string) {
+	begin := time.Now()
+
+	entry, ok := p.entries[index]
+	if !ok {
+		entry = &ProfileEntry{Name: name}
+		p.entries[index] = entry
+	}
+	entry.Calls++
+
+	p.active[index]++
+
+	parent := p.root
+	if len(p.frames) > 0 {
+		parent = p.frames[len(p.frames)-1].sample
+	}
+	sample := parent.child(index, p.samples)
+
+	start := time.Now()
+	p.overhead += start.Sub(begin)
+	p.frames = append(p.frames, profileFrame{index: index, start: start, overhead: p.overhead, sample: sample})
+}
+
+// exit is called when the most recently entered word finishes executing.
+func (p *profiler) exit() {
+
+	// Stop the clock before doing anything else.
+	now := time.Now()
+
+	// This shouldn't happen, but be careful.
+	if len(p.frames) == 0 {
+		return
+	}
+
+	frame := p.frames[len(p.frames)-1]
+	elapsed := now.Sub(frame.start) - (p.overhead - frame.overhead)
+	exclusive := elapsed - frame.children
+
+	p.frames = p.frames[:len(p.frames)-1]
+
+	// Update the totals for this word
+	entry := p.entries[frame.index]
+	entry.Exclusive += exclusive
+
+	p.active[frame.index]--
+	if p.active[frame.index] == 0 {
+		entry.Inclusive += elapsed
+	}
+
+	// Update the totals for this call-stack
+	frame.sample.calls++
+	frame.sample.exclusive += exclusive
+
+	// Our caller spent this time in us.
+	if len(p.frames) > 0 {
+		p.frames[len(p.frames)-1].children += elapsed
+	}
+
+	p.overhead += time.Since(now)
+}
+
+// Profile returns the results of the current, or most recent, profiling
+// run, sorted so that the words with the greatest exclusive time come first.
+func (e *Eval) Profile() []ProfileEntry {
+
+	var res []ProfileEntry
+	if e.profiler == nil {
+		return res
+	}
+
+	for _, entry := range e.profiler.entries {
+		res = append(res, *entry)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Exclusive != res[j].Exclusive {
+			return res[i].Exclusive > res[j].Exclusive
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// SetProfiling enables, or disables, the profiler.
+//
+// Enabling the profiler discards the results of any previous run.
+func (e *Eval) SetProfiling(enabled bool) {
+	if enabled && !e.profiling {
+		e.profiler = newProfiler()
+	}
+	e.profiling = enabled
+}
+
+// WriteProfileReport writes a human-readable report of the profiling
+// results to the given writer.
+func (e *Eval) WriteProfileReport(w io.Writer) error {
+
+	_, err := fmt.Fprintf(w, "%10s %14s %14s  %s\n", "calls", "inclusive", "exclusive", "word")
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range e.Profile() {
+		_, err = fmt.Fprintf(w, "%10d %14s %14s  %s\n", entry.Calls, entry.Inclusive, entry.Exclusive, entry.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WritePprof writes the profiling results to the given writer, in the
+// gzipped protocol-buffer format which `go tool pprof` understands.
+//
+// Each word is presented as a function, and the call-stacks which were
+// seen are recorded as samples with two values; the number of calls,
+// and the exclusive time spent.
+func (e *Eval) WritePprof(w io.Writer) error {
+
+	p := e.profiler
+	if p == nil {
+		p = newProfiler()
+	}
+
+	// The string-table must start with the empty string.
+	strs := []string{""}
+	strIndex := map[string]int64{"": 0}
+	str := func(s string) int64 {
+		if idx, ok := strIndex[s]; ok {
+			return idx
+		}
+		strs = append(strs, s)
+		strIndex[s] = int64(len(strs) - 1)
+		return strIndex[s]
+	}
+
+	var out protoBuffer
+
+	// sample_type
+	for _, st := range [][2]string{{"calls", "count"}, {"time", "nanoseconds"}} {
+		var vt protoBuffer
+		vt.varint(1, uint64(str(st[0])))
+		vt.varint(2, uint64(str(st[1])))
+		out.message(1, &vt)
+	}
+
+	// sample - in a stable order, for reproducible output
+	keys := make([]string, 0, len(p.samples))
+	for key := range p.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		sample := p.samples[key]
+
+		// Locations are listed innermost first.
+		locs := make([]uint64, len(sample.stack))
+		for i, idx := range sample.stack {
+			locs[len(locs)-1-i] = uint64(idx) + 1
+		}
+
+		var sm protoBuffer
+		sm.packed(1, locs)
+		sm.packed(2, []uint64{uint64(sample.calls), uint64(sample.exclusive.Nanoseconds())})
+		out.message(2, &sm)
+	}
+
+	// location & function - one per word which was called.
+	indexes := make([]int, 0, len(p.entries))
+	for idx := range p.entries {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	for _, idx := range indexes {
+		var line protoBuffer
+		line.varint(1, uint64(idx)+1)
+
+		var loc protoBuffer
+		loc.varint(1, uint64(idx)+1)
+		loc.message(4, &line)
+		out.message(4, &loc)
+	}
+	for _, idx := range indexes {
+		var fn protoBuffer
+		fn.varint(1, uint64(idx)+1)
+		fn.varint(2, uint64(str(p.entries[idx].Name)))
+		fn.varint(3, uint64(str(p.entries[idx].Name)))
+		out.message(5, &fn)
+	}
+
+	// period_type has to be in the string-table, so we create it before
+	// the table is written.
+	var pt protoBuffer
+	pt.varint(1, uint64(str("time")))
+	pt.varint(2, uint64(str("nanoseconds")))
+
+	// string_table
+	for _, s := range strs {
+		out.bytes(6, []byte(s))
+	}
+
+	// time_nanos, duration_nanos, period_type, period
+	out.varint(9, uint64(p.started.UnixNano()))
+	out.varint(10, uint64(time.Since(p.started).Nanoseconds()))
+	out.message(11, &pt)
+	out.varint(12, 1)
+
+	gz := gzip.NewWriter(w)
+	_, err := gz.Write(out.Bytes())
+	if err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// protoBuffer is a minimal protocol-buffer encoder, which is just enough
+// to allow us to write pprof profiles without an external dependency.
+type protoBuffer struct {
+	bytes.Buffer
+}
+
+// rawVarint writes the given value as a base-128 varint.
+func (b *protoBuffer) rawVarint(v uint64) {
+	for v >= 0x80 {
+		b.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	b.WriteByte(byte(v))
+}
+
+// varint writes a varint-encoded field.
+func (b *protoBuffer) varint(field int, v uint64) {
+	b.rawVarint(uint64(field)<<3 | 0)
+	b.rawVarint(v)
+}
+
+// bytes writes a length-delimited field.
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.rawVarint(uint64(field)<<3 | 2)
+	b.rawVarint(uint64(len(data)))
+	b.Write(data)
+}
+
+// message writes an embedded message.
+func (b *protoBuffer) message(field int, m *protoBuffer) {
+	b.bytes(field, m.Bytes())
+}
+
+// packed writes a packed repeated-varint field.
+func (b *protoBuffer) packed(field int, values []uint64) {
+	var tmp protoBuffer
+	for _, v := range values {
+		tmp.rawVarint(v)
+	}
+	b.bytes(field, tmp.Bytes())
+}
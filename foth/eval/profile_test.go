@@ -0,0 +1,189 @@
+package eval
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+
+	e := New()
+
+	// No results before we've started
+	if len(e.Profile()) != 0 {
+		t.Fatalf("unexpected profile results")
+	}
+
+	err := e.Eval(": sq dup * ; : work 10 0 do i sq drop loop ;")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	// Enable profiling, and run our word twice
+	err = e.Eval("1 profile work work 0 profile")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	calls := make(map[string]ProfileEntry)
+	for _, entry := range e.Profile() {
+		calls[entry.Name] = entry
+	}
+
+	if calls["work"].Calls != 2 {
+		t.Fatalf("wrong number of calls for work: %d", calls["work"].Calls)
+	}
+	if calls["sq"].Calls != 20 {
+		t.Fatalf("wrong number of calls for sq: %d", calls["sq"].Calls)
+	}
+	if calls["dup"].Calls != 20 {
+		t.Fatalf("wrong number of calls for dup: %d", calls["dup"].Calls)
+	}
+	if calls["work"].Inclusive < calls["sq"].Inclusive {
+		t.Fatalf("inclusive time of work should include sq")
+	}
+	if calls["work"].Exclusive > calls["work"].Inclusive {
+		t.Fatalf("exclusive time cannot exceed inclusive time")
+	}
+
+	// Each call-stack is recorded once, however often it was seen
+	key := fmt.Sprintf("%d,%d,%d", e.findWord("work"), e.findWord("sq"), e.findWord("dup"))
+	sample, ok := e.profiler.samples[key]
+	if !ok {
+		t.Fatalf("missing call-stack %s", key)
+	}
+	if sample.calls != 20 || len(sample.stack) != 3 {
+		t.Fatalf("wrong results for call-stack %s: %d calls", key, sample.calls)
+	}
+
+	// Profiling is off, so running again doesn't change the counts
+	err = e.Eval("work")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	for _, entry := range e.Profile() {
+		if entry.Name == "work" && entry.Calls != 2 {
+			t.Fatalf("calls were recorded while profiling was disabled")
+		}
+	}
+
+	// Recursion doesn't inflate the inclusive time
+	err = e.Eval(": factorial recursive dup 1 > if dup 1 - factorial * then ; 1 profile 10 factorial 0 profile")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	for _, entry := range e.Profile() {
+		if entry.Name == "factorial" {
+			if entry.Calls != 10 {
+				t.Fatalf("wrong number of calls for factorial: %d", entry.Calls)
+			}
+		}
+		if entry.Name == "work" {
+			t.Fatalf("enabling the profiler should discard old results")
+		}
+	}
+}
+
+func TestProfileWords(t *testing.T) {
+
+	var b bytes.Buffer
+	out := bufio.NewWriter(&b)
+
+	e := New()
+	e.SetWriter(out)
+
+	err := e.Eval("profile? 1 profile profile? 42 emit .profile")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	on, _ := e.Stack.Pop()
+	off, _ := e.Stack.Pop()
+	if on != 1 || off != 0 {
+		t.Fatalf("profile? returned the wrong values")
+	}
+
+	if !strings.Contains(b.String(), "exclusive") {
+		t.Fatalf("report missing header: %s", b.String())
+	}
+	if !strings.Contains(b.String(), "emit") {
+		t.Fatalf("report missing word: %s", b.String())
+	}
+
+	// empty stack
+	e = New()
+	err = e.profileSet()
+	if err == nil {
+		t.Fatalf("expected error with empty stack")
+	}
+}
+
+func TestWritePprof(t *testing.T) {
+
+	e := New()
+	e.SetProfiling(true)
+
+	err := e.Eval(": star 42 emit ; : stars 0 do star loop ;")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	var b bytes.Buffer
+	e.SetWriter(bufio.NewWriter(&b))
+	err = e.Eval("3 stars")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	var out bytes.Buffer
+	err = e.WritePprof(&out)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	// The output should be gzipped
+	gz, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("profile wasn't gzipped: %s", err.Error())
+	}
+	data, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("failed to decompress profile: %s", err.Error())
+	}
+
+	// The first field is a sample_type; field 1, length-delimited
+	if len(data) == 0 || data[0] != 0x0a {
+		t.Fatalf("unexpected profile contents")
+	}
+
+	// Our word-names are present in the string-table
+	for _, name := range []string{"stars", "star", "emit", "nanoseconds"} {
+		if !bytes.Contains(data, []byte(name)) {
+			t.Fatalf("profile didn't contain %s", name)
+		}
+	}
+}
+
+func TestProtoBuffer(t *testing.T) {
+
+	var p protoBuffer
+	p.varint(1, 300)
+
+	// field 1, varint, followed by 300 as a varint
+	expected := []byte{0x08, 0xac, 0x02}
+	if !bytes.Equal(p.Bytes(), expected) {
+		t.Fatalf("unexpected encoding: %v", p.Bytes())
+	}
+
+	p.Reset()
+	p.packed(2, []uint64{1, 2, 3})
+	expected = []byte{0x12, 0x03, 0x01, 0x02, 0x03}
+	if !bytes.Equal(p.Bytes(), expected) {
+		t.Fatalf("unexpected encoding: %v", p.Bytes())
+	}
+}
@@ -0,0 +1,417 @@
+// This file contains our string-heap, and the words which operate upon
+// strings.
+//
+// Strings are referred to by their offset within the heap, which is
+// pushed upon the stack like any other integer.  Strings which are
+// created at runtime, by `accept`, `s+`, and similar words, are
+// reclaimed once nothing refers to them.
+//
+// As offsets are plain integers we can't tell whether a particular
+// number refers to a string, or not.  So any integer on either stack,
+// or within our memory, arrays, maps, or local variables, keeps the string
+// at that offset alive.  Strings which are used by compiled words are
+// never reclaimed.
+
+package eval
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/skx/foth/foth/stack"
+)
+
+// minCollect is the number of live strings we allow before the first
+// collection of unused strings.
+const minCollect = 64
+
+// stringState describes an entry within the string-heap.
+type stringState int
+
+const (
+	// stringFree entries are unused, and may be reused.
+	stringFree stringState = iota
+
+	// stringUsed entries are in use, until nothing refers to them.
+	stringUsed
+
+	// stringConst entries are used by compiled words, and so are
+	// never reclaimed.
+	stringConst
+)
+
+// stringHeap holds the strings we've created.
+type stringHeap struct {
+	// values holds the contents of each string.
+	values []string
+
+	// state holds the state of each entry.
+	state []stringState
+
+	// free holds the offsets of the unused entries.
+	free []int
+
+	// live is the number of entries which are in use.
+	live int
+
+	// bytes is the total length of the entries which are in use.
+	bytes int
+
+	// next is the number of live entries at which we'll next look
+	// for strings to reclaim.
+	next int
+}
+
+// PushString adds a new string to the heap, and pushes its offset to the
+// top of the stack.
+//
+// This is designed to be used by host-applications which embed
+// this library.
+func (e *Eval) PushString(str string) error {
+	return e.pushString(str)
+}
+
+// PopString removes the string offset on the top of the stack, and
+// returns the string it refers to.
+//
+// This is designed to be used by host-applications which embed
+// this library.
+func (e *Eval) PopString() (string, error) {
+	return e.popString()
+}
+
+// addString adds the given string to our string-heap, and returns the
+// offset at which it was stored.
+//
+// The string will be reclaimed once nothing refers to it.
+func (e *Eval) addString(str string) (int, error) {
+	return e.storeString(str, stringUsed)
+}
+
+// addConstString adds the given string to our string-heap, and returns
+// the offset at which it was stored.
+//
+// The string will never be reclaimed, which is required for strings used
+// by compiled words.
+func (e *Eval) addConstString(str string) (int, error) {
+	return e.storeString(str, stringConst)
+}
+
+// storeString adds a string to our heap, reusing an unused entry if
+// there is one, and collecting unused strings if the heap has grown.
+func (e *Eval) storeString(str string, state stringState) (int, error) {
+	heap := &e.strings
+
+	if e.stringLimited(len(str)) || heap.live >= heap.next {
+		e.collectStrings()
+	}
+	if e.stringLimited(len(str)) {
+		return 0, ErrStringLimit
+	}
+
+	heap.live++
+	heap.bytes += len(str)
+	if len(heap.free) > 0 {
+		idx := heap.free[len(heap.free)-1]
+		heap.free = heap.free[:len(heap.free)-1]
+		heap.values[idx] = str
+		heap.state[idx] = state
+		return idx, nil
+	}
+
+	heap.values = append(heap.values, str)
+	heap.state = append(heap.state, state)
+	return len(heap.values) - 1, nil
+}
+
+// stringLimited returns true if storing a string of the given length
+// would exceed our limits.
+func (e *Eval) stringLimited(length int) bool {
+	heap := &e.strings
+
+	if e.limits.MaxStrings > 0 && heap.live >= e.limits.MaxStrings {
+		return true
+	}
+	return e.limits.MaxStringBytes > 0 && heap.bytes+length > e.limits.MaxStringBytes
+}
+
+// collectStrings reclaims the strings which nothing refers to.
+func (e *Eval) collectStrings() {
+	heap := &e.strings
+
+	marked := make([]bool, len(heap.values))
+	mark := func(c stack.Cell) {
+		idx, err := toInt(c)
+		if err == nil && idx >= 0 && idx < int64(len(marked)) {
+			marked[idx] = true
+		}
+	}
+
+	for _, c := range e.Stack {
+		mark(c)
+	}
+	for _, c := range e.FStack {
+		mark(c)
+	}
+	for _, c := range e.memory {
+		mark(c)
+	}
+	for _, a := range e.arrays {
+		for _, c := range a.values {
+			mark(c)
+		}
+	}
+	for _, m := range e.maps {
+		for _, c := range m.values {
+			mark(c)
+		}
+	}
+	for _, l := range e.locals {
+		for _, c := range l {
+			mark(c)
+		}
+	}
+
+	for i, state := range heap.state {
+		if state == stringUsed && !marked[i] {
+			heap.bytes -= len(heap.values[i])
+			heap.values[i] = ""
+			heap.state[i] = stringFree
+			heap.free = append(heap.free, i)
+			heap.live--
+		}
+	}
+
+	heap.next = 2 * heap.live
+	if heap.next < minCollect {
+		heap.next = minCollect
+	}
+}
+
+// getString returns the string at the given offset within our heap.
+func (e *Eval) getString(c stack.Cell) (string, error) {
+	idx, err := toInt(c)
+	if err != nil || idx < 0 || idx >= int64(len(e.strings.values)) || e.strings.state[idx] == stringFree {
+		return "", fmt.Errorf("invalid stack offset for string reference")
+	}
+	return e.strings.values[idx], nil
+}
+
+// popString removes the string offset on the top of the stack, and
+// returns the string it refers to.
+func (e *Eval) popString() (string, error) {
+	c, err := e.Stack.PopCell()
+	if err != nil {
+		return "", err
+	}
+	return e.getString(c)
+}
+
+// pushString adds a new string to the heap, and pushes its offset.
+func (e *Eval) pushString(str string) error {
+	idx, err := e.addString(str)
+	if err != nil {
+		return err
+	}
+	e.Stack.PushInt(int64(idx))
+	return nil
+}
+
+// stringOp returns a function which replaces the string on the top of
+// the stack with the result of calling the given function upon it.
+func (e *Eval) stringOp(op func(string) string) func() error {
+	return func() error {
+		str, err := e.popString()
+		if err != nil {
+			return err
+		}
+		return e.pushString(op(str))
+	}
+}
+
+// floatToString replaces the number on the top of the floating-point
+// stack with a string, pushed to the stack, showing it as `f.` would.
+func (e *Eval) floatToString() error {
+	n, err := e.popFloat()
+	if err != nil {
+		return err
+	}
+	return e.pushString(e.formatNumber(n))
+}
+
+// lower converts a string to lower-case.
+func (e *Eval) lower() error {
+	return e.stringOp(strings.ToLower)()
+}
+
+// numberToString replaces the number on the top of the stack with a
+// string, showing it as `.` would - i.e. in the current base.
+func (e *Eval) numberToString() error {
+	n, err := e.Stack.PopCell()
+	if err != nil {
+		return err
+	}
+	return e.pushString(e.formatNumber(n))
+}
+
+// stringToNumber replaces the string on the top of the stack with the
+// number it contains, failing if it doesn't contain one.
+//
+// The string is parsed in the same way as a number within our input,
+// ignoring any leading or trailing whitespace.
+func (e *Eval) stringToNumber() error {
+	str, err := e.popString()
+	if err != nil {
+		return err
+	}
+	str = strings.TrimSpace(str)
+	n, err := e.parseNumber(str)
+	if err != nil {
+		return fmt.Errorf("failed to convert %s to number", str)
+	}
+	e.Stack.PushCell(n)
+	return nil
+}
+
+// stringToNumberp is like stringToNumber, except it pushes 1 after the
+// number.  If the string doesn't contain a number 0 is pushed twice.
+func (e *Eval) stringToNumberp() error {
+	str, err := e.popString()
+	if err != nil {
+		return err
+	}
+	n, err := e.parseNumber(strings.TrimSpace(str))
+	if err != nil {
+		e.Stack.PushInt(0)
+		e.Stack.PushInt(0)
+		return nil
+	}
+	e.Stack.PushCell(n)
+	e.Stack.PushInt(1)
+	return nil
+}
+
+// split splits a string at each occurrence of a separator, pushing each
+// part followed by the number of parts.
+//
+// An empty separator splits the string into its characters.
+func (e *Eval) split() error {
+	sep, err := e.popString()
+	if err != nil {
+		return err
+	}
+	str, err := e.popString()
+	if err != nil {
+		return err
+	}
+
+	parts := strings.Split(str, sep)
+	for _, part := range parts {
+		err = e.pushString(part)
+		if err != nil {
+			return err
+		}
+	}
+	e.Stack.PushInt(int64(len(parts)))
+	return e.checkStack()
+}
+
+// strcat joins two strings.
+func (e *Eval) strcat() error {
+	b, err := e.popString()
+	if err != nil {
+		return err
+	}
+	a, err := e.popString()
+	if err != nil {
+		return err
+	}
+	return e.pushString(a + b)
+}
+
+// strcmp compares two strings, pushing -1 if the first sorts before the
+// second, 1 if it sorts after it, and 0 if they're equal.
+func (e *Eval) strcmp() error {
+	b, err := e.popString()
+	if err != nil {
+		return err
+	}
+	a, err := e.popString()
+	if err != nil {
+		return err
+	}
+	e.Stack.PushInt(int64(strings.Compare(a, b)))
+	return nil
+}
+
+// strfind pushes the offset, in characters, of the first occurrence of a
+// string within another, or -1 if it isn't present.
+func (e *Eval) strfind() error {
+	needle, err := e.popString()
+	if err != nil {
+		return err
+	}
+	str, err := e.popString()
+	if err != nil {
+		return err
+	}
+	idx := strings.Index(str, needle)
+	if idx > 0 {
+		idx = utf8.RuneCountInString(str[:idx])
+	}
+	e.Stack.PushInt(int64(idx))
+	return nil
+}
+
+// strrev reverses a string.
+func (e *Eval) strrev() error {
+	return e.stringOp(func(str string) string {
+		runes := []rune(str)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return string(runes)
+	})()
+}
+
+// substr pushes the part of a string which starts at the given offset,
+// and has the given length - both of which are counted in characters.
+//
+// The length is truncated if it would run past the end of the string.
+func (e *Eval) substr() error {
+	length, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	start, err := e.popInt()
+	if err != nil {
+		return err
+	}
+	str, err := e.popString()
+	if err != nil {
+		return err
+	}
+
+	runes := []rune(str)
+	if start < 0 || start > int64(len(runes)) {
+		return fmt.Errorf("substr: offset %d is outside the string", start)
+	}
+	if length < 0 {
+		return fmt.Errorf("substr: invalid length %d", length)
+	}
+	if length > int64(len(runes))-start {
+		length = int64(len(runes)) - start
+	}
+	return e.pushString(string(runes[start : start+length]))
+}
+
+// trim removes leading and trailing whitespace from a string.
+func (e *Eval) trim() error {
+	return e.stringOp(strings.TrimSpace)()
+}
+
+// upper converts a string to upper-case.
+func (e *Eval) upper() error {
+	return e.stringOp(strings.ToUpper)()
+}
@@ -0,0 +1,265 @@
+package eval
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStringWords(t *testing.T) {
+
+	type TestCase struct {
+		input  string
+		output string
+	}
+
+	tests := []TestCase{
+		{`"foo" "bar" s+ strprn`, "foobar"},
+		{`"foo" "" s+ strprn`, "foo"},
+		{`"Hello, World" 7 5 substr strprn`, "World"},
+		{`"Hello" 2 100 substr strprn`, "llo"},
+		{`"Hello" 5 1 substr strlen .`, "0 "},
+		{`"Hello, World" "World" strfind .`, "7 "},
+		{`"Hello, World" "world" strfind .`, "-1 "},
+		{`"Hello" "" strfind .`, "0 "},
+		{`"apple" "banana" strcmp .`, "-1 "},
+		{`"banana" "apple" strcmp .`, "1 "},
+		{`"apple" "apple" strcmp .`, "0 "},
+		{`"Hello" upper strprn`, "HELLO"},
+		{`"Hello" lower strprn`, "hello"},
+		{`"  padded\t " trim strprn`, "padded"},
+		{`"stressed" strrev strprn`, "desserts"},
+		{`"" strrev strlen .`, "0 "},
+		{`"a,b,c" "," split . strprn strprn strprn`, "3 cba"},
+		{`"abc" "" split . strprn strprn strprn`, "3 cba"},
+		{`"abc" ";" split . strprn`, "1 abc"},
+		{`: greet "Hello, " swap s+ strprn ; "Steve" greet`, "Hello, Steve"},
+		{`variable x "kept" x ! x @ strprn`, "kept"},
+
+		// lengths and offsets are counted in characters
+		{`"café" strlen .`, "4 "},
+		{`"café" strblen .`, "5 "},
+		{`"\u{1F600}" strlen . "\u{1F600}" strblen .`, "1 4 "},
+		{`"naïve café" "café" strfind .`, "6 "},
+		{`"naïve café" 2 3 substr strprn`, "ïve"},
+		{`"世界" strrev strprn`, "界世"},
+		{`"ÉCOLE" lower strprn`, "école"},
+		{`'é' emit '\u{263A}' emit`, "é☺"},
+		{`."naïve\u{21}"`, "naïve!"},
+	}
+
+	for _, test := range tests {
+
+		e := New()
+		out := e.CaptureOutput()
+
+		err := e.Eval(test.input)
+		if err != nil {
+			t.Fatalf("unexpected error evaluating '%s': %s", test.input, err.Error())
+		}
+		if out.String() != test.output {
+			t.Fatalf("'%s' gave '%s', not '%s'", test.input, out.String(), test.output)
+		}
+		if !e.Stack.IsEmpty() {
+			t.Fatalf("'%s' left items on the stack", test.input)
+		}
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+
+	tests := []string{
+		"s+",
+		`"foo" s+`,
+		`"foo" 100 s+`,
+		`"foo" 1 substr`,
+		`"foo" -1 1 substr`,
+		`"foo" 4 1 substr`,
+		`"foo" 1 -1 substr`,
+		`"foo" 1.5 1 substr`,
+		`"foo" strfind`,
+		`"foo" strcmp`,
+		"upper",
+		"lower",
+		"trim",
+		"strrev",
+		`"foo" split`,
+		"100 strprn",
+		"-1 strlen",
+		"1.5 strlen",
+	}
+
+	for _, test := range tests {
+		e := New()
+		err := e.Eval(test)
+		if err == nil {
+			t.Fatalf("expected an error evaluating '%s'", test)
+		}
+	}
+}
+
+func TestStringCollection(t *testing.T) {
+
+	e := New()
+
+	// Strings which are dropped are reclaimed
+	err := e.Eval(`"kept" variable x x ! 1000 0 do "a" "b" s+ drop loop`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if len(e.strings.values) > 2*minCollect {
+		t.Fatalf("the heap grew to %d entries", len(e.strings.values))
+	}
+
+	e.collectStrings()
+
+	// The loop's strings are constant, and "kept" is referred to,
+	// but any integer may refer to a string - so the value of
+	// `base` might keep one more alive.
+	err = e.Eval("strings")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	n, _ := e.Stack.Pop()
+	if n < 3 || n > 4 {
+		t.Fatalf("expected 3 or 4 live strings, got %f", n)
+	}
+
+	// But those referred to are still present
+	out := e.CaptureOutput()
+	err = e.Eval(`x @ strprn`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if out.String() != "kept" {
+		t.Fatalf("wrong output '%s'", out.String())
+	}
+
+	// Strings on the stacks survive a collection too
+	free := len(e.strings.free)
+	e.PushString("stack")
+	e.Eval("\"float\" >f")
+	e.collectStrings()
+	e.Eval("f>")
+
+	for _, expected := range []string{"float", "stack"} {
+		str, err := e.PopString()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		if str != expected {
+			t.Fatalf("expected '%s', got '%s'", expected, str)
+		}
+	}
+
+	// Now nothing refers to them they're reclaimed, and the entries
+	// reused
+	e.collectStrings()
+	if len(e.strings.free) != free {
+		t.Fatalf("expected %d free entries, got %d", free, len(e.strings.free))
+	}
+	size := len(e.strings.values)
+	e.PushString("reused")
+	if len(e.strings.values) != size {
+		t.Fatalf("the free entry wasn't reused")
+	}
+}
+
+func TestStringLimit(t *testing.T) {
+
+	e := New()
+	e.SetLimits(Limits{MaxStrings: 4})
+
+	// Dropped strings don't count against the limit, but the two
+	// used by the loop do
+	err := e.Eval(`10 0 do "a" "b" s+ drop loop`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	err = e.Eval(`"one" "two" "three"`)
+	if !errors.Is(err, ErrStringLimit) {
+		t.Fatalf("expected string limit, got %v", err)
+	}
+}
+
+func TestPopString(t *testing.T) {
+
+	e := New()
+
+	_, err := e.PopString()
+	if err == nil {
+		t.Fatalf("expected error with empty stack")
+	}
+
+	e.Stack.PushInt(42)
+	_, err = e.PopString()
+	if err == nil {
+		t.Fatalf("expected error with an invalid string")
+	}
+}
+
+func TestStringConversions(t *testing.T) {
+
+	type TestCase struct {
+		input  string
+		output string
+	}
+
+	tests := []TestCase{
+		{`"42" >number 1 + .`, "43 "},
+		{`" 42 " >number .`, "42 "},
+		{`"-2.5" >number .`, "-2.5 "},
+		{`"1/3r" >number .`, "1/3 "},
+		{`"$ff" >number .`, "255 "},
+		{`hex "ff" >number decimal .`, "255 "},
+		{`"42" s>number? . .`, "1 42 "},
+		{`"forty" s>number? . .`, "0 0 "},
+		{`"" s>number? . .`, "0 0 "},
+		{`binary "101" s>number? decimal . .`, "1 5 "},
+		{`42 number>string strprn`, "42"},
+		{`-2.5 number>string strlen .`, "4 "},
+		{`hex 255 decimal number>string strprn`, "597"},
+		{`hex ff number>string decimal strprn`, "FF"},
+		{`1/3r number>string strprn`, "1/3"},
+		{`1.25 >f f>string strprn`, "1.25"},
+		{`3 set-precision 1 3 / >f f>string strprn`, "0.333"},
+		{`"7" >number number>string "7" strcmp .`, "0 "},
+	}
+
+	for _, test := range tests {
+
+		e := New()
+		out := e.CaptureOutput()
+
+		err := e.Eval(test.input)
+		if err != nil {
+			t.Fatalf("unexpected error evaluating '%s': %s", test.input, err.Error())
+		}
+		if out.String() != test.output {
+			t.Fatalf("'%s' gave '%s', not '%s'", test.input, out.String(), test.output)
+		}
+		if !e.Stack.IsEmpty() {
+			t.Fatalf("'%s' left items on the stack", test.input)
+		}
+	}
+
+	// Errors
+	errs := []string{
+		">number",
+		`"forty" >number`,
+		`"1.5" hex >number`,
+		"100 >number",
+		"s>number?",
+		"100 s>number?",
+		"number>string",
+		"f>string",
+	}
+
+	for _, test := range errs {
+		e := New()
+		err := e.Eval(test)
+		if err == nil {
+			t.Fatalf("expected an error evaluating '%s'", test)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// This file contains the tracing support, which allows a host
+// application to receive structured events as words are executed.
+
+package eval
+
+import "github.com/skx/foth/foth/stack"
+
+// TraceKind describes the type of a TraceEvent.
+type TraceKind int
+
+const (
+	// TraceWordEnter is sent when a word begins executing.
+	TraceWordEnter TraceKind = iota
+
+	// TraceWordExit is sent when a word finishes executing.
+	TraceWordExit
+
+	// TraceOpcode is sent before each opcode within a compiled
+	// word is executed.
+	TraceOpcode
+
+	// TraceVariable is sent when a variable is written.
+	TraceVariable
+
+	// TracePrint is sent when a string is written to STDOUT.
+	TracePrint
+)
+
+// String returns a description of the event-kind.
+func (k TraceKind) String() string {
+	switch k {
+	case TraceWordEnter:
+		return "enter"
+	case TraceWordExit:
+		return "exit"
+	case TraceOpcode:
+		return "opcode"
+	case TraceVariable:
+		return "variable"
+	case TracePrint:
+		return "print"
+	}
+	return "unknown"
+}
+
+// TraceEvent is a single event which is delivered to the function
+// registered via SetTracer.
+//
+// Only the fields relevant to the Kind of event will be populated.
+type TraceEvent struct {
+	// Kind holds the type of this event.
+	Kind TraceKind
+
+	// Word holds the name of the word being entered, exited, or which
+	// contains the opcode being executed.
+	Word string
+
+	// IP holds the offset of the opcode, within the word, which is
+	// about to be executed.
+	IP int
+
+	// Opcode holds the opcode which is about to be executed.
+	Opcode float64
+
+	// Stack holds a copy of the stack, as it was when the event
+	// was generated.
+	Stack []stack.Cell
+
+	// Variable holds the name of the variable which was written.
+	Variable string
+
+	// Value holds the value written to the variable.
+	Value stack.Cell
+
+	// Text holds the string which was printed.
+	Text string
+
+	// Err holds the error, if any, with which a word exited.
+	Err error
+}
+
+// SetTracer registers a function to receive events as our words are
+// executed.  Passing nil disables tracing.
+//
+// This is designed to be used by host-applications which embed this
+// library, and wish to build logs, visualizations, or audit-trails.
+func (e *Eval) SetTracer(tracer func(TraceEvent)) {
+	e.tracer = tracer
+}
+
+// trace delivers the given event to our tracer, adding a snapshot of
+// the stack.
+func (e *Eval) trace(event TraceEvent) {
+	if e.tracer == nil {
+		return
+	}
+
+	event.Stack = make([]stack.Cell, e.Stack.Len())
+	for i := range event.Stack {
+		event.Stack[i] = e.Stack.AtCell(i)
+	}
+
+	e.tracer(event)
+}
@@ -0,0 +1,147 @@
+package eval
+
+import (
+	"bufio"
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/skx/foth/foth/stack"
+)
+
+func TestTraceKind(t *testing.T) {
+
+	kinds := map[TraceKind]string{
+		TraceWordEnter: "enter",
+		TraceWordExit:  "exit",
+		TraceOpcode:    "opcode",
+		TraceVariable:  "variable",
+		TracePrint:     "print",
+		TraceKind(99):  "unknown",
+	}
+
+	for kind, name := range kinds {
+		if kind.String() != name {
+			t.Fatalf("wrong name for %d: %s", kind, kind.String())
+		}
+	}
+}
+
+func TestTracer(t *testing.T) {
+
+	var b bytes.Buffer
+
+	e := New()
+	e.SetWriter(bufio.NewWriter(&b))
+
+	var events []TraceEvent
+	e.SetTracer(func(ev TraceEvent) {
+		events = append(events, ev)
+	})
+
+	err := e.Eval("variable x : store 3 x ! ; : show .\" hi\" ; store show")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	// Find the interesting events
+	var entered, exited, opcodes, written, printed int
+	for _, ev := range events {
+		switch ev.Kind {
+		case TraceWordEnter:
+			entered++
+		case TraceWordExit:
+			exited++
+			if ev.Err != nil {
+				t.Fatalf("unexpected error in exit event: %v", ev.Err)
+			}
+		case TraceOpcode:
+			opcodes++
+			if ev.Word == "store" && ev.IP == 0 && ev.Opcode != -2 {
+				t.Fatalf("unexpected opcode at start of store: %f", ev.Opcode)
+			}
+		case TraceVariable:
+			written++
+			if ev.Variable != "x" || ev.Value != stack.IntCell(3) {
+				t.Fatalf("unexpected variable event: %v", ev)
+			}
+			if len(ev.Stack) != 0 {
+				t.Fatalf("stack snapshot should be empty after the write")
+			}
+		case TracePrint:
+			printed++
+			if ev.Text != " hi" {
+				t.Fatalf("unexpected print event: %v", ev)
+			}
+		}
+	}
+
+	if entered == 0 || entered != exited {
+		t.Fatalf("mismatched enter/exit events: %d/%d", entered, exited)
+	}
+	if opcodes == 0 {
+		t.Fatalf("no opcode events seen")
+	}
+	if written != 1 {
+		t.Fatalf("expected one variable event, got %d", written)
+	}
+	if printed != 1 {
+		t.Fatalf("expected one print event, got %d", printed)
+	}
+
+	// Errors are reported when exiting
+	events = nil
+	err = e.Eval(": fail drop ; fail")
+	if err == nil {
+		t.Fatalf("expected an error, got none")
+	}
+	last := events[len(events)-1]
+	if last.Kind != TraceWordExit || last.Word != "fail" || last.Err == nil {
+		t.Fatalf("unexpected final event: %v", last)
+	}
+
+	// Stack snapshots are copies
+	events = nil
+	err = e.Eval("1 2 +")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if len(events[0].Stack) != 2 || events[0].Stack[0] != stack.IntCell(1) || events[0].Stack[1] != stack.IntCell(2) {
+		t.Fatalf("unexpected stack snapshot: %v", events[0].Stack)
+	}
+
+	// Values keep their full precision
+	events = nil
+	err = e.Eval("variable big 9007199254740993 big !")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	for _, ev := range events {
+		if ev.Kind == TraceVariable && ev.Value.Int() != 9007199254740993 {
+			t.Fatalf("variable event lost precision: %v", ev.Value)
+		}
+	}
+
+	e.Reset()
+	events = nil
+	err = e.Eval("1000000000000 >big dup * drop")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	want, _ := new(big.Int).SetString("1000000000000000000000000", 10)
+	last = events[len(events)-2]
+	if last.Word != "drop" || last.Stack[0].Big().Cmp(want) != 0 {
+		t.Fatalf("stack snapshot lost precision: %v", events)
+	}
+
+	// Disabling the tracer stops events
+	events = nil
+	e.SetTracer(nil)
+	err = e.Eval("store")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if len(events) != 0 {
+		t.Fatalf("received events after disabling the tracer")
+	}
+}
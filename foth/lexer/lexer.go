@@ -3,6 +3,9 @@ package lexer
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 // Type holds the type of a node
@@ -20,6 +23,12 @@ const (
 	// e.g. ."Steve"
 	PSTRING = "pstring"
 
+	// ASTRING is a string literal, enclosed in quotes, which
+	// follows the word `abort`.  It holds the message to show
+	// when aborting.
+	// e.g. abort" Steve"
+	ASTRING = "astring"
+
 	// WORD is anything which is not a STRING or PSTRING.
 	//
 	// This includes words, numbers, and other symbols which
@@ -34,7 +43,7 @@ const (
 
 // Token is a single token.
 //
-// All our tokens have a name and type, only our two string-types have a value
+// All our tokens have a name and type, only our string-types have a value
 // which is used for anything.
 type Token struct {
 
@@ -46,6 +55,10 @@ type Token struct {
 
 	// For the case of a string-literal we store the value here.
 	Value string
+
+	// Line holds the line-number, within the input, on which the
+	// token ended.  The first line is line 1.
+	Line int
 }
 
 // Lexer holds our state.
@@ -54,8 +67,17 @@ type Lexer struct {
 	// input is the string we were given
 	input string
 
-	// offset points to the character we're currently looking at
+	// offset points to the character we're currently looking at.
+	//
+	// This is a byte-offset, characters may be several bytes long.
 	offset int
+
+	// line is the number of newlines which occur before lineOffset.
+	//
+	// We keep track of these to avoid rescanning our input each time
+	// we need to know the current line-number.
+	line       int
+	lineOffset int
 }
 
 // New creates a new lexer which allows parsing a string of FORTH tokens
@@ -71,24 +93,26 @@ func (l *Lexer) Tokens() ([]Token, error) {
 
 	// We walk the input from start to finish
 	l.offset = 0
+	l.line = 0
+	l.lineOffset = 0
 
 	// Value of the current token - built up character by character.
 	cur := ""
 
 	for l.offset < len(l.input) {
 
-		c := l.input[l.offset]
-		switch string(c) {
+		c, size := utf8.DecodeRuneInString(l.input[l.offset:])
+		switch c {
 
-		case " ", "\n", "\r", "\t":
+		case ' ', '\n', '\r', '\t':
 
 			// If we've built up a word then we save it away.
 			if len(cur) != 0 {
-				res = append(res, Token{Name: cur, Type: WORD})
+				res = append(res, l.token(Token{Name: cur, Type: WORD}))
 				cur = ""
 			}
 
-		case "\\":
+		case '\\':
 			// Comment to the end of the line
 			for l.offset < len(l.input) {
 				if l.input[l.offset] == '\n' {
@@ -97,28 +121,33 @@ func (l *Lexer) Tokens() ([]Token, error) {
 				l.offset++
 			}
 
-		case "'":
-			// We parse 'x' as the ASCII code of the character x.
-
-			// can we peek ahead two characters?
-			if l.offset+2 < len(l.input) {
-
-				// confirm we have a close
-				if string(l.input[l.offset+2]) == "'" {
+		case '\'':
+			// We parse 'x' as the character code of the character
+			// x, which may be any character, or an escape such as
+			// '\n' or '\u{e9}'.
+			//
+			// The code has a "#" prefix, so that it is always
+			// treated as a decimal number, regardless of the
+			// current number-base.
+			l.offset++
 
-					c = l.input[l.offset+1]
-					d := int(c)
-					s := fmt.Sprintf("%d", d)
-					res = append(res, Token{Name: s, Type: WORD})
-					l.offset += 2
-				} else {
-					return res, fmt.Errorf("syntax error")
-				}
-			} else {
+			d, err := l.readChar()
+			if err != nil {
+				return res, err
+			}
+			if l.offset >= len(l.input) {
 				return res, fmt.Errorf("unterminated single-character constant")
 			}
 
-		case "(":
+			// confirm we have a close
+			if l.input[l.offset] != '\'' {
+				return res, fmt.Errorf("syntax error")
+			}
+
+			s := fmt.Sprintf("#%d", d)
+			res = append(res, l.token(Token{Name: s, Type: WORD}))
+
+		case '(':
 
 			// skip the "("
 			l.offset++
@@ -143,7 +172,7 @@ func (l *Lexer) Tokens() ([]Token, error) {
 			}
 
 			// This is for strings
-		case "\"":
+		case '"':
 
 			// skip the opening """
 			l.offset++
@@ -154,10 +183,20 @@ func (l *Lexer) Tokens() ([]Token, error) {
 				return nil, err
 			}
 
-			res = append(res, Token{Name: "\"", Value: str, Type: STRING})
+			// abort" xxx " is the only word which may run
+			// directly into a string.
+			if strings.ToLower(cur) == "abort" {
+				res = append(res, l.token(Token{Name: "abort\"", Value: str, Type: ASTRING}))
+				cur = ""
+			} else {
+				res = append(res, l.token(Token{Name: "\"", Value: str, Type: STRING}))
+			}
+
+			// We skip the character following the string
+			_, size = utf8.DecodeRuneInString(l.input[l.offset:])
 
 			// This is for ." xxx "
-		case ".":
+		case '.':
 
 			// ensure we don't walk off the array
 			if l.offset+1 < len(l.input) {
@@ -173,7 +212,10 @@ func (l *Lexer) Tokens() ([]Token, error) {
 						return nil, err
 					}
 
-					res = append(res, Token{Name: ".\"", Value: str, Type: PSTRING})
+					res = append(res, l.token(Token{Name: ".\"", Value: str, Type: PSTRING}))
+
+					// We skip the character following the string
+					_, size = utf8.DecodeRuneInString(l.input[l.offset:])
 				} else {
 					cur = cur + "."
 				}
@@ -183,78 +225,117 @@ func (l *Lexer) Tokens() ([]Token, error) {
 		default:
 			cur = cur + string(c)
 		}
-		l.offset++
+		l.offset += size
 	}
 
 	// end token?
 	if cur != "" {
-		res = append(res, Token{Name: cur, Type: WORD})
+		res = append(res, l.token(Token{Name: cur, Type: WORD}))
 	}
 
 	// All done.
 	return res, nil
 }
 
+// token updates the given token with the current line-number, and
+// returns it.
+func (l *Lexer) token(tok Token) Token {
+
+	// Count the newlines we've passed since we were last called.
+	for l.lineOffset < l.offset && l.lineOffset < len(l.input) {
+		if l.input[l.lineOffset] == '\n' {
+			l.line++
+		}
+		l.lineOffset++
+	}
+
+	tok.Line = l.line + 1
+	return tok
+}
+
 // readString is called to read until a close of the string
 // is encountered.  (i.e. ").
 func (l *Lexer) readString() (string, error) {
 
 	// We're now inside a string
-	closed := false
-	val := ""
+	var val strings.Builder
 
 	for l.offset < len(l.input) {
 
-		c := l.input[l.offset]
-
-		if c == '"' {
-			closed = true
+		if l.input[l.offset] == '"' {
 			l.offset++
-			break
+			return val.String(), nil
 		}
 
-		// Handle \n, etc.
-		if c == '\\' {
+		// Read the next character, handling \n, etc.
+		c, err := l.readChar()
+		if err != nil {
+			return val.String(), err
+		}
+		val.WriteRune(c)
+	}
 
-			// if there is another character
-			if l.offset+1 < len(l.input) {
+	// Failed to close the string
+	return val.String(), fmt.Errorf("unterminated string")
+}
 
-				// look at what it is
-				l.offset++
-				c := l.input[l.offset]
+// readChar reads a single character, from within a string or a
+// character constant, handling escapes such as "\n" and "\u{e9}".
+func (l *Lexer) readChar() (rune, error) {
 
-				if c == 'n' {
-					c = '\n'
-				}
-				if c == 'r' {
-					c = '\r'
-				}
-				if c == 't' {
-					c = '\t'
-				}
-				if c == '"' {
-					c = '"'
-				}
-				if c == '\\' {
-					c = '\\'
-				}
+	if l.offset >= len(l.input) {
+		return 0, fmt.Errorf("unterminated single-character constant")
+	}
 
-				val += string(c)
-				l.offset++
-				continue
-			}
-		}
+	c, size := utf8.DecodeRuneInString(l.input[l.offset:])
+	if c == utf8.RuneError && size == 1 {
+		return 0, fmt.Errorf("invalid UTF-8 in input")
+	}
+	l.offset += size
 
-		// default
-		val += string(l.input[l.offset])
-		l.offset++
+	// A backslash at the very end is left alone.
+	if c != '\\' || l.offset >= len(l.input) {
+		return c, nil
 	}
 
-	// Failed to close the string?
-	if !closed {
-		return val, fmt.Errorf("unterminated string")
+	// look at what follows
+	c, size = utf8.DecodeRuneInString(l.input[l.offset:])
+	l.offset += size
+
+	switch c {
+	case 'n':
+		return '\n', nil
+	case 'r':
+		return '\r', nil
+	case 't':
+		return '\t', nil
+	case 'u':
+		return l.readUnicode()
 	}
 
-	// Returned okay
-	return val, nil
+	// Anything else, including \" and \\, is used literally.
+	return c, nil
+}
+
+// readUnicode reads the hexadecimal code of a character, within braces,
+// following "\u" - as in "\u{e9}".
+func (l *Lexer) readUnicode() (rune, error) {
+
+	if l.offset >= len(l.input) || l.input[l.offset] != '{' {
+		return 0, fmt.Errorf("invalid unicode escape, expected \\u{...}")
+	}
+
+	end := strings.IndexByte(l.input[l.offset:], '}')
+	if end < 0 {
+		return 0, fmt.Errorf("unterminated unicode escape")
+	}
+
+	hex := l.input[l.offset+1 : l.offset+end]
+	l.offset += end + 1
+
+	code, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || code > utf8.MaxRune || !utf8.ValidRune(rune(code)) {
+		return 0, fmt.Errorf("invalid unicode escape \\u{%s}", hex)
+	}
+	return rune(code), nil
 }
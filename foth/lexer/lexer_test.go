@@ -30,7 +30,7 @@ func TestCharacter(t *testing.T) {
 	if len(out) != 1 {
 		t.Fatalf("wrong number of tokens")
 	}
-	if out[0].Name != "42" {
+	if out[0].Name != "#42" {
 		t.Fatalf("unexpected result: %v", out[0].Name)
 	}
 
@@ -98,6 +98,72 @@ func TestEscapeCharacters(t *testing.T) {
 	}
 }
 
+// Characters may be multi-byte, or escaped
+func TestUnicodeCharacters(t *testing.T) {
+
+	type TestCase struct {
+		input  string
+		output string
+	}
+
+	tests := []TestCase{
+		{`'é'`, "#233"},
+		{`'世'`, "#19990"},
+		{`'\n'`, "#10"},
+		{`'\''`, "#39"},
+		{`'\u{e9}'`, "#233"},
+		{`'\u{1F600}'`, "#128512"},
+	}
+
+	for _, test := range tests {
+		out, err := New(test.input).Tokens()
+		if err != nil {
+			t.Fatalf("error lexing %s: %s", test.input, err)
+		}
+		if len(out) != 1 || out[0].Name != test.output {
+			t.Fatalf("%s gave %v, not %s", test.input, out, test.output)
+		}
+	}
+
+	// Strings, and words, may contain multi-byte characters too
+	out, err := New(`." café \u{263A}\u{1F600}" naïve "世界"`).Tokens()
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	if len(out) != 3 {
+		t.Fatalf("Unexpected output, got: %v", out)
+	}
+	if out[0].Value != " café ☺😀" {
+		t.Fatalf("got bad string: '%s'", out[0].Value)
+	}
+	if out[1].Name != "naïve" {
+		t.Fatalf("got bad word: '%s'", out[1].Name)
+	}
+	if out[2].Value != "世界" {
+		t.Fatalf("got bad string: '%s'", out[2].Value)
+	}
+
+	// Invalid escapes, and input, are errors
+	invalid := []string{
+		`"\u{}"`,
+		`"\u{zz}"`,
+		`"\u{110000}"`,
+		`"\u{D800}"`,
+		`"\u{41"`,
+		`"\u41"`,
+		`'\u{zz}'`,
+		`'é`,
+		`'éé'`,
+		"\"\xff\"",
+	}
+	for _, test := range invalid {
+		_, err := New(test).Tokens()
+		if err == nil {
+			t.Fatalf("expected an error lexing %s", test)
+		}
+	}
+}
+
 // Unterminated comments are a bug
 func TestCommentUnterminated(t *testing.T) {
 
@@ -174,6 +240,32 @@ func TestString2(t *testing.T) {
 
 }
 
+// abort" is lexed into a single token
+func TestAbortString(t *testing.T) {
+
+	l := New("start ABORT\" bad input\" end")
+	out, err := l.Tokens()
+
+	if err != nil {
+		t.Fatalf("error lexing")
+	}
+	if len(out) != 3 {
+		t.Fatalf("Unexpected output, got: %v", out)
+	}
+	if out[1].Name != "abort\"" {
+		t.Fatalf("got bad string")
+	}
+	if out[1].Type != ASTRING {
+		t.Fatalf("got bad type")
+	}
+	if out[1].Value != " bad input" {
+		t.Fatalf("got bad string: '%s'", out[1].Value)
+	}
+	if out[2].Name != "end" {
+		t.Fatalf("got bad suffix")
+	}
+}
+
 // Unterminated strings are a bug
 func TestStringUnterminated(t *testing.T) {
 
@@ -220,3 +312,24 @@ func TestNotString(t *testing.T) {
 	}
 
 }
+
+// Tokens record the line they were found upon
+func TestLineNumbers(t *testing.T) {
+
+	l := New("one two\n( comment\n ) three \" multi\nline \"\n\n four")
+
+	out, err := l.Tokens()
+	if err != nil {
+		t.Fatalf("unexpected error")
+	}
+
+	expected := []int{1, 1, 3, 4, 6}
+	if len(out) != len(expected) {
+		t.Fatalf("Unexpected output, got: %v", out)
+	}
+	for i, tok := range out {
+		if tok.Line != expected[i] {
+			t.Fatalf("token %s had line %d, not %d", tok.Name, tok.Line, expected[i])
+		}
+	}
+}
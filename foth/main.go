@@ -8,20 +8,103 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"strings"
 
 	"github.com/skx/foth/foth/eval"
 )
 
+// lineWriter writes our output to STDOUT, keeping track of whether the
+// last thing written was a newline.
+//
+// Since `.` doesn't output a newline this allows us to make sure that
+// our prompt, and any errors, start upon a fresh line.
+type lineWriter struct {
+	atStart bool
+}
+
+// Write writes the given bytes to STDOUT.
+func (l *lineWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		l.atStart = p[len(p)-1] == '\n'
+	}
+	return os.Stdout.Write(p)
+}
+
+// newline outputs a newline, if we're not at the start of a line.
+func (l *lineWriter) newline() {
+	if !l.atStart {
+		l.Write([]byte("\n"))
+	}
+}
+
+// stdout is where the output of our interpreter is sent.
+var stdout = &lineWriter{atStart: true}
+
 // "secret" word
 func secret() error {
 	fmt.Printf("nothing happens\n")
 	return nil
 }
 
+// evalInterruptible evaluates the given text, allowing it to be
+// cancelled by pressing Ctrl-C.
+func evalInterruptible(ev *eval.Eval, text string) error {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Only catch the signal while we're running, so that
+	// Ctrl-C still terminates us at the prompt.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	defer signal.Stop(sigs)
+
+	go func() {
+		select {
+		case <-sigs:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ev.EvalContext(ctx, text)
+}
+
+// showAbort prints the message associated with an `abort`, returning
+// true if the given error was the result of one.
+func showAbort(err error) bool {
+	var abort *eval.AbortError
+	if !errors.As(err, &abort) {
+		return false
+	}
+	if abort.Message != "" {
+		stdout.newline()
+		fmt.Printf("%s\n", abort.Message)
+	}
+	return true
+}
+
+// showError prints the given error, along with the backtrace showing
+// the words which were executing, if available.
+func showError(err error) {
+	stdout.newline()
+	fmt.Printf("ERROR: %s\n", err.Error())
+
+	var runtime *eval.Error
+	if errors.As(err, &runtime) {
+		for _, frame := range runtime.Backtrace {
+			fmt.Printf("  in %s\n", frame)
+		}
+	}
+}
+
 // If the given file exists, read the contents, and evaluate it
 func doInit(ev *eval.Eval, path string) error {
 
@@ -31,14 +114,17 @@ func doInit(ev *eval.Eval, path string) error {
 	}
 
 	reader := bufio.NewReader(handle)
+	num := 0
 	line, err := reader.ReadString(byte('\n'))
 	for err == nil {
+		num++
 
 		// Trim it
 		line = strings.TrimSpace(line)
 
 		// Evaluate
-		err = ev.Eval(line)
+		ev.SetPosition(path, num)
+		err = evalInterruptible(ev, line)
 		if err != nil {
 
 			// This error is generated by the "QUIT" word, and
@@ -48,11 +134,16 @@ func doInit(ev *eval.Eval, path string) error {
 				return nil
 			}
 
-			// OK a _real_ error was received.
-			fmt.Printf("ERROR: %s\n", err.Error())
+			// An abort has already reset the state, and
+			// just needs its message shown.
+			if !showAbort(err) {
+
+				// OK a _real_ error was received.
+				showError(err)
 
-			// Reset our state, to allow recovery
-			ev.Reset()
+				// Reset our state, to allow recovery
+				ev.Reset()
+			}
 		}
 
 		// Repeat
@@ -71,10 +162,44 @@ func doInit(ev *eval.Eval, path string) error {
 	return nil
 }
 
+// showProfile outputs the results of profiling, once we're finished.
+func showProfile(ev *eval.Eval, path string) {
+
+	ev.SetProfiling(false)
+	ev.WriteProfileReport(os.Stdout)
+
+	if path == "" {
+		return
+	}
+
+	handle, err := os.Create(path)
+	if err != nil {
+		fmt.Printf("error creating %s: %s\n", path, err.Error())
+		return
+	}
+	defer handle.Close()
+
+	err = ev.WritePprof(handle)
+	if err != nil {
+		fmt.Printf("error writing %s: %s\n", path, err.Error())
+	}
+}
+
 func main() {
 
+	profile := flag.Bool("profile", false, "Profile execution, and show a report on exit.")
+	profileOutput := flag.String("profile-output", "", "Write a profile to the named file on exit, for use with 'go tool pprof'.")
+	dotNewline := flag.Bool("dot-newline", false, "Make '.' output a newline after each number, as it used to, rather than a space.")
+	flag.Parse()
+
 	reader := bufio.NewReader(os.Stdin)
 	forth := eval.New()
+	forth.SetOutput(stdout)
+	forth.SetDotNewline(*dotNewline)
+
+	// Share our reader, so that input read by words such as `accept`
+	// doesn't get lost in a separate buffer.
+	forth.SetReader(reader)
 
 	forth.Dictionary = append(forth.Dictionary, eval.Word{Name: "xyzzy", Function: secret})
 
@@ -83,20 +208,33 @@ func main() {
 	// i.e. Run the file, but ignore errors.
 	doInit(forth, "foth.4th")
 
+	// Profile everything after our init-file.
+	if *profile || *profileOutput != "" {
+		forth.SetProfiling(true)
+		defer showProfile(forth, *profileOutput)
+	}
+
 	// If we got any arguments treat them as files to lead
-	if len(os.Args) > 1 {
-		for _, file := range os.Args[1:] {
+	if len(flag.Args()) > 0 {
+		for _, file := range flag.Args() {
 			err := doInit(forth, file)
 			if err != nil {
+				stdout.newline()
 				fmt.Printf("error running %s: %s\n", file, err.Error())
 				return
 			}
 		}
+		stdout.newline()
 		return
 	}
 
-	// No arguments, just run the REPL
+	// No arguments, just run the REPL - with a debugger.
+	debug := &debugger{reader: reader}
+	forth.SetDebugger(debug.pause)
+
+	num := 0
 	for {
+		stdout.newline()
 		fmt.Printf("> ")
 
 		// Read input
@@ -108,8 +246,15 @@ func main() {
 
 		// Trim it
 		text = strings.TrimSpace(text)
+		num++
+
+		// Setting a breakpoint?
+		if debug.command(forth, text) {
+			continue
+		}
 
-		err = forth.Eval(text)
+		forth.SetPosition("<stdin>", num)
+		err = evalInterruptible(forth, text)
 		if err != nil {
 
 			// This error is generated by the "QUIT" word, and
@@ -119,10 +264,15 @@ func main() {
 				return
 			}
 
-			fmt.Printf("ERROR: %s\n", err.Error())
+			// An abort has already reset the state, and
+			// just needs its message shown.
+			if !showAbort(err) {
+
+				showError(err)
 
-			// Reset our state, to allow recovery
-			forth.Reset()
+				// Reset our state, to allow recovery
+				forth.Reset()
+			}
 		}
 
 	}
@@ -1,15 +1,222 @@
-// Package stack allows a stack of float64 to be maintained.
+// Package stack allows a stack of numbers to be maintained.
+//
+// Each entry on the stack is a Cell, which holds an integer, a
+// floating-point number, an arbitrary-precision integer, a rational
+// number, or a reference to an array or map.
 package stack
 
 import (
 	"fmt"
+	"math/big"
+	"strconv"
 )
 
+// Kind describes the type of value held within a Cell.
+type Kind int
+
+const (
+	// Float cells hold a float64.
+	Float Kind = iota
+
+	// Int cells hold an int64.
+	Int
+
+	// BigInt cells hold an arbitrary-precision integer.
+	BigInt
+
+	// BigRat cells hold an arbitrary-precision rational number.
+	BigRat
+
+	// Array cells hold a reference to an array, which is stored
+	// elsewhere.
+	Array
+
+	// Map cells hold a reference to a map, which is stored elsewhere.
+	Map
+)
+
+// Cell holds a single value.
+type Cell struct {
+	// Kind holds the type of this cell.
+	Kind Kind
+
+	// I holds the value of Int cells, and the reference held by
+	// Array and Map cells.
+	I int64
+
+	// F holds the value of Float cells.
+	F float64
+
+	// B holds the value of BigInt cells.
+	//
+	// The value is shared by copies of the cell, so it must never
+	// be modified.
+	B *big.Int
+
+	// R holds the value of BigRat cells.
+	//
+	// The value is shared by copies of the cell, so it must never
+	// be modified.
+	R *big.Rat
+}
+
+// FloatCell returns a cell holding the given floating-point number.
+func FloatCell(f float64) Cell {
+	return Cell{Kind: Float, F: f}
+}
+
+// IntCell returns a cell holding the given integer.
+func IntCell(i int64) Cell {
+	return Cell{Kind: Int, I: i}
+}
+
+// BigIntCell returns a cell holding the given arbitrary-precision integer.
+func BigIntCell(b *big.Int) Cell {
+	return Cell{Kind: BigInt, B: b}
+}
+
+// BigRatCell returns a cell holding the given rational number.
+func BigRatCell(r *big.Rat) Cell {
+	return Cell{Kind: BigRat, R: r}
+}
+
+// ArrayCell returns a cell holding a reference to the given array.
+func ArrayCell(ref int64) Cell {
+	return Cell{Kind: Array, I: ref}
+}
+
+// MapCell returns a cell holding a reference to the given map.
+func MapCell(ref int64) Cell {
+	return Cell{Kind: Map, I: ref}
+}
+
+// IsReference returns true if the cell holds a reference to an array,
+// or a map, rather than a number.
+func (c Cell) IsReference() bool {
+	return c.Kind == Array || c.Kind == Map
+}
+
+// IsInteger returns true if the cell holds an integer, of either size.
+func (c Cell) IsInteger() bool {
+	return c.Kind == Int || c.Kind == BigInt
+}
+
+// Float returns the value of the cell, as a floating-point number.
+func (c Cell) Float() float64 {
+	switch c.Kind {
+	case Int, Array, Map:
+		return float64(c.I)
+	case BigInt:
+		f, _ := new(big.Float).SetInt(c.B).Float64()
+		return f
+	case BigRat:
+		f, _ := c.R.Float64()
+		return f
+	}
+	return c.F
+}
+
+// Int returns the value of the cell, as an integer.
+//
+// Floating-point, and rational, values are truncated towards zero, and
+// arbitrary-precision integers which are too large are truncated to
+// their low-order bits.
+func (c Cell) Int() int64 {
+	switch c.Kind {
+	case Int, Array, Map:
+		return c.I
+	case BigInt:
+		return c.B.Int64()
+	case BigRat:
+		return new(big.Int).Quo(c.R.Num(), c.R.Denom()).Int64()
+	}
+	return int64(c.F)
+}
+
+// Big returns the value of an integer cell, of either size, as an
+// arbitrary-precision integer.
+//
+// The result must not be modified.
+func (c Cell) Big() *big.Int {
+	if c.Kind == BigInt {
+		return c.B
+	}
+	return big.NewInt(c.I)
+}
+
+// Rat returns the value of a cell which isn't a floating-point number
+// as a rational number.
+//
+// The result must not be modified.
+func (c Cell) Rat() *big.Rat {
+	switch c.Kind {
+	case BigRat:
+		return c.R
+	case BigInt:
+		return new(big.Rat).SetInt(c.B)
+	}
+	return new(big.Rat).SetInt64(c.I)
+}
+
+// String returns the value of the cell, as a string.
+func (c Cell) String() string {
+	switch c.Kind {
+	case Int:
+		return strconv.FormatInt(c.I, 10)
+	case BigInt:
+		return c.B.String()
+	case BigRat:
+		return c.R.RatString()
+	case Array:
+		return fmt.Sprintf("<array %d>", c.I)
+	case Map:
+		return fmt.Sprintf("<map %d>", c.I)
+	}
+	return strconv.FormatFloat(c.F, 'g', -1, 64)
+}
+
+// Compare compares the values of two cells, returning -1 if a is less
+// than b, 1 if a is greater than b, and 0 if they are equal.
+//
+// Integers and rational numbers are compared exactly, but if either
+// value is a floating-point number then both are compared as
+// floating-point numbers.
+func Compare(a Cell, b Cell) int {
+	if a.Kind == Int && b.Kind == Int {
+		switch {
+		case a.I < b.I:
+			return -1
+		case a.I > b.I:
+			return 1
+		}
+		return 0
+	}
+
+	if a.Kind != Float && b.Kind != Float {
+		return a.Rat().Cmp(b.Rat())
+	}
+
+	x := a.Float()
+	y := b.Float()
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
 // Stack holds our numbers.
-type Stack []float64
+type Stack []Cell
 
-// At returns the value at the given offset.
+// At returns the value at the given offset, as a floating-point number.
 func (s *Stack) At(offset int) float64 {
+	return (*s)[offset].Float()
+}
+
+// AtCell returns the cell at the given offset.
+func (s *Stack) AtCell(offset int) Cell {
 	return (*s)[offset]
 }
 
@@ -23,15 +230,35 @@ func (s *Stack) Len() int {
 	return len(*s)
 }
 
-// Push adds a new number to the top of the stack.
+// Push adds a new floating-point number to the top of the stack.
 func (s *Stack) Push(x float64) {
-	*s = append(*s, x)
+	s.PushCell(FloatCell(x))
 }
 
-// Pop removes, and returns, the top element of stack.
+// PushInt adds a new integer to the top of the stack.
+func (s *Stack) PushInt(x int64) {
+	s.PushCell(IntCell(x))
+}
+
+// PushCell adds a new cell to the top of the stack.
+func (s *Stack) PushCell(c Cell) {
+	*s = append(*s, c)
+}
+
+// Pop removes, and returns, the top element of stack as a
+// floating-point number.
 func (s *Stack) Pop() (float64, error) {
+	c, err := s.PopCell()
+	if err != nil {
+		return 0, err
+	}
+	return c.Float(), nil
+}
+
+// PopCell removes, and returns, the top cell of the stack.
+func (s *Stack) PopCell() (Cell, error) {
 	if s.IsEmpty() {
-		return 0, fmt.Errorf("stack underflow")
+		return Cell{}, fmt.Errorf("stack underflow")
 	}
 
 	i := len(*s) - 1
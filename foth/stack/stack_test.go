@@ -1,6 +1,7 @@
 package stack
 
 import (
+	"math/big"
 	"testing"
 )
 
@@ -39,3 +40,95 @@ func TestUnderflow(t *testing.T) {
 		t.Fatalf("stack was not covered")
 	}
 }
+
+func TestCells(t *testing.T) {
+
+	var s Stack
+
+	s.PushInt(9007199254740993)
+	s.Push(1.5)
+
+	f, _ := s.PopCell()
+	if f.Kind != Float || f.Float() != 1.5 || f.Int() != 1 || f.String() != "1.5" {
+		t.Fatalf("float cell was wrong: %v", f)
+	}
+
+	i, _ := s.PopCell()
+	if i.Kind != Int || i.Int() != 9007199254740993 || i.String() != "9007199254740993" {
+		t.Fatalf("int cell was wrong: %v", i)
+	}
+
+	_, err := s.PopCell()
+	if err == nil {
+		t.Fatalf("stack was not covered")
+	}
+}
+
+func TestCompare(t *testing.T) {
+
+	type TestCase struct {
+		a   Cell
+		b   Cell
+		out int
+	}
+
+	tests := []TestCase{
+		{IntCell(9007199254740993), IntCell(9007199254740992), 1},
+		{IntCell(1), IntCell(2), -1},
+		{IntCell(2), FloatCell(2), 0},
+		{FloatCell(2.5), IntCell(2), 1},
+		{FloatCell(1.5), FloatCell(2.5), -1},
+		{BigIntCell(big.NewInt(3)), IntCell(3), 0},
+		{BigRatCell(big.NewRat(1, 3)), BigRatCell(big.NewRat(1, 4)), 1},
+		{BigRatCell(big.NewRat(1, 2)), FloatCell(0.5), 0},
+		{IntCell(1), BigRatCell(big.NewRat(3, 2)), -1},
+	}
+
+	for _, test := range tests {
+		if Compare(test.a, test.b) != test.out {
+			t.Fatalf("wrong result comparing %v and %v", test.a, test.b)
+		}
+	}
+}
+
+func TestBigCells(t *testing.T) {
+
+	b := BigIntCell(big.NewInt(-12))
+	if !b.IsInteger() || b.Float() != -12 || b.Int() != -12 || b.String() != "-12" {
+		t.Fatalf("big cell was wrong: %v", b)
+	}
+
+	r := BigRatCell(big.NewRat(-7, 2))
+	if r.IsInteger() || r.Float() != -3.5 || r.Int() != -3 || r.String() != "-7/2" {
+		t.Fatalf("rational cell was wrong: %v", r)
+	}
+
+	if IntCell(4).Big().Int64() != 4 || IntCell(4).Rat().RatString() != "4" {
+		t.Fatalf("conversion of integer cell was wrong")
+	}
+	if b.Rat().RatString() != "-12" {
+		t.Fatalf("conversion of big cell was wrong")
+	}
+}
+
+func TestReferenceCells(t *testing.T) {
+
+	a := ArrayCell(3)
+	if a.IsInteger() || a.Int() != 3 || a.Float() != 3 || a.String() != "<array 3>" {
+		t.Fatalf("array cell was wrong: %v", a)
+	}
+
+	if !a.IsReference() || IntCell(3).IsReference() {
+		t.Fatalf("array cell should be a reference")
+	}
+
+	m := MapCell(2)
+	if !m.IsReference() || m.Int() != 2 || m.String() != "<map 2>" {
+		t.Fatalf("map cell was wrong: %v", m)
+	}
+
+	// arrays are compared by reference
+	if Compare(a, ArrayCell(3)) != 0 || Compare(a, ArrayCell(4)) != -1 {
+		t.Fatalf("array comparison was wrong")
+	}
+}